@@ -1,14 +1,11 @@
 package cmd
 
 import (
-	"bytes"
 	"errors"
 	"fmt"
-	"os/exec"
 	"regexp"
 	"sort"
 	"strings"
-	"sync"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -26,25 +23,24 @@ var aclsCmd = &cobra.Command{
 			fmt.Println("Display acls of ", s.cluster)
 			if strings.TrimSpace(acls_topic) != "" {
 				topics := strings.Split(acls_topic, ",")
-				var wg sync.WaitGroup
+				var tasks TASKS
 				for _, topic := range topics {
-					wg.Add(1)
-					go func(t string) {
+					t := topic
+					tasks.Go(s.bootstrap, func() {
 						result, err := acls_cmdWithTopic(s.bootstrap, t)
 						if err != nil {
 							log.Error(err)
 						} else {
-							acls := extractAcls(result)
+							acls := selectAcls(extractAcls(result))
 							fmt.Println(acls)
 						}
-						wg.Done()
-					}(topic)
+					})
 				}
-				wg.Wait()
+				tasks.Wait()
 			} else {
 				result, err := acls_cmd(s.bootstrap)
 				logFatal(err)
-				acls := extractAcls(result)
+				acls := selectAcls(extractAcls(result))
 				fmt.Println(acls_toString(acls))
 			}
 		}
@@ -55,36 +51,22 @@ var acls_topic string
 
 func init() {
 	rootCmd.AddCommand(aclsCmd)
-	// Cobra supports local flags which will only run when this command is called directly, e.g.:
-	aclsCmd.Flags().StringVarP(&acls_topic, "topic", "t", "", "Topic names using comma as separator (e.g. topic1,topic2)")
+	// Persistent, so that acl compare filters on the same --topic
+	aclsCmd.PersistentFlags().StringVarP(&acls_topic, "topic", "t", "", "Topic names using comma as separator (e.g. topic1,topic2)")
 }
 
 func acls_cmdWithTopic(servers, topic string) (string, error) {
 	if err := check_conn(servers); err != nil {
 		return "", errors.New("No connection to the VMs\n" + err.Error())
 	}
-	log.Debug("Run command : kafka-acls.sh --bootstrap-server " + servers + " --list --topic " + topic)
-	ecmd := exec.Command("kafka-acls.sh", "--bootstrap-server", servers, "--list", "--topic", topic)
-	var out bytes.Buffer
-	ecmd.Stdout = &out
-	if err := ecmd.Run(); err != nil {
-		return "", err
-	}
-	return out.String(), nil
+	return runCommand("kafka-acls.sh", "--bootstrap-server", servers, "--list", "--topic", topic)
 }
 
 func acls_cmd(servers string) (string, error) {
 	if err := check_conn(servers); err != nil {
 		return "", errors.New("No connection to the VMs\n" + err.Error())
 	}
-	log.Debug("Run command : kafka-acls.sh --bootstrap-server " + servers + " --list")
-	ecmd := exec.Command("kafka-acls.sh", "--bootstrap-server", servers, "--list")
-	var out bytes.Buffer
-	ecmd.Stdout = &out
-	if err := ecmd.Run(); err != nil {
-		return "", err
-	}
-	return out.String(), nil
+	return runCommand("kafka-acls.sh", "--bootstrap-server", servers, "--list")
 }
 
 type ACL struct {
@@ -95,6 +77,7 @@ type ACL struct {
 type PERM struct {
 	user, host, perm string
 	r, w, d          bool
+	others           []string // operations other than READ, WRITE and DESCRIBE (e.g. ALL, CREATE)
 }
 
 func (a ACL) String() string {
@@ -108,7 +91,7 @@ func (a ACL) String() string {
 func (a *ACL) updateAcl(user, host, oper, perm string) {
 	for i := range a.perms {
 		p := &a.perms[i]
-		if p.user == user && p.host == host {
+		if p.user == user && p.host == host && p.perm == perm {
 			p.updatePerm(oper)
 			return
 		}
@@ -144,6 +127,10 @@ func (p *PERM) updatePerm(oper string) {
 		p.w = true
 	case "DESCRIBE":
 		p.d = true
+	default:
+		if !inArray(p.others, oper) {
+			p.others = append(p.others, oper)
+		}
 	}
 }
 
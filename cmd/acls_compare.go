@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// Represent the acls compare command
+var aclsCompareCmd = &cobra.Command{
+	Use:   "compare",
+	Short: "[ERDING] Compare the acls of several clusters",
+	Long: `Load the acls of all given clusters and display the bindings which are not present on all clusters,
+  or which do not have the same operations on all clusters.
+	e.g. go run kstat.go -c bkt28,bkp28 acl compare
+	e.g. go run kstat.go -c bkt28,bkp28 -t topic1,topic2 acl compare `,
+
+	Run: func(cmd *cobra.Command, args []string) {
+		servers, err := initServers()
+		logFatal(err)
+		if len(servers) < 2 {
+			logFatal(errors.New("At least two clusters are needed to compare acls (e.g. -c bkt28,bkp28)"))
+		}
+		acls := make([][]ACL, len(servers))
+		errs := make([]error, len(servers))
+		var tasks TASKS
+		for i := range servers {
+			i := i
+			tasks.Go(servers[i].bootstrap, func() {
+				acls[i], errs[i] = acls_load(servers[i].bootstrap)
+			})
+		}
+		tasks.Wait()
+		clusters := make([]string, 0)
+		bindings := make(map[string]map[string]string)
+		for i, s := range servers {
+			if errs[i] != nil {
+				logErr(errors.New(s.cluster + " excluded from the comparison : " + errs[i].Error()))
+				continue
+			}
+			clusters = append(clusters, s.cluster)
+			for k, ops := range aclsToBindings(acls[i]) {
+				if bindings[k] == nil {
+					bindings[k] = make(map[string]string)
+				}
+				bindings[k][s.cluster] = ops
+			}
+		}
+		fmt.Println("Compare acls of", strings.Join(clusters, ", "))
+		fmt.Print(compareBindings(clusters, bindings))
+	},
+}
+
+func init() {
+	aclsCmd.AddCommand(aclsCompareCmd)
+}
+
+// Load the acls of a cluster, restricted to the topics given with --topic if any
+func acls_load(servers string) ([]ACL, error) {
+	if strings.TrimSpace(acls_topic) == "" {
+		result, err := acls_cmd(servers)
+		if err != nil {
+			return nil, err
+		}
+		return selectAcls(extractAcls(result)), nil
+	}
+	acls := make([]ACL, 0)
+	for _, t := range strings.Split(acls_topic, ",") {
+		result, err := acls_cmdWithTopic(servers, t)
+		if err != nil {
+			return nil, err
+		}
+		acls = append(acls, extractAcls(result)...)
+	}
+	return selectAcls(acls), nil
+}
+
+// Flatten the acls into bindings (resource + principal + host + permission) along with their operations
+func aclsToBindings(acls []ACL) map[string]string {
+	bindings := make(map[string]string)
+	for _, a := range acls {
+		for _, p := range a.perms {
+			key := fmt.Sprintf("%s %s (%s) %s %s %s", a.rtype, a.topic, a.ptype, p.perm, p.host, p.user)
+			bindings[key] = p.operations()
+		}
+	}
+	return bindings
+}
+
+// Return all the operations of the permission as a sorted, comma separated, string
+func (p PERM) operations() string {
+	ops := make([]string, 0)
+	if p.r {
+		ops = append(ops, "READ")
+	}
+	if p.w {
+		ops = append(ops, "WRITE")
+	}
+	if p.d {
+		ops = append(ops, "DESCRIBE")
+	}
+	ops = append(ops, p.others...)
+	sort.Strings(ops)
+	return strings.Join(ops, ",")
+}
+
+// Display the bindings missing on some clusters, then the ones whose operations differ between clusters
+func compareBindings(clusters []string, bindings map[string]map[string]string) string {
+	keys := make([]string, 0, len(bindings))
+	for k := range bindings {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	missing, differ := "", ""
+	for _, k := range keys {
+		b := bindings[k]
+		present, absent := make([]string, 0), make([]string, 0)
+		for _, c := range clusters {
+			if _, ok := b[c]; ok {
+				present = append(present, c)
+			} else {
+				absent = append(absent, c)
+			}
+		}
+		if len(absent) > 0 {
+			missing += fmt.Sprintf("  %s [%s]\n\tonly in : %s\n", k, b[present[0]], strings.Join(present, ","))
+			continue
+		}
+		same := true
+		for _, c := range clusters[1:] {
+			if b[c] != b[clusters[0]] {
+				same = false
+				break
+			}
+		}
+		if !same {
+			differ += fmt.Sprintf("  %s\n", k)
+			for _, c := range clusters {
+				differ += fmt.Sprintf("\t%s : [%s]\n", c, b[c])
+			}
+		}
+	}
+	if missing == "" && differ == "" {
+		return "All bindings are identical\n"
+	}
+	s := ""
+	if missing != "" {
+		s += "Bindings not present on all clusters:\n" + missing
+	}
+	if differ != "" {
+		s += "Bindings with different operations:\n" + differ
+	}
+	return s
+}
@@ -0,0 +1,40 @@
+package cmd
+
+import "testing"
+
+func TestExtractAclsGolden(t *testing.T) {
+	replayTestdata(t)
+	out, err := acls_cmd(fixtureBootstrap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "acls", acls_toString(extractAcls(out)))
+}
+
+func TestAclsToBindingsKeepsDeny(t *testing.T) {
+	replayTestdata(t)
+	out, err := acls_cmd(fixtureBootstrap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bindings := aclsToBindings(extractAcls(out))
+	for key, ops := range map[string]string{
+		"TOPIC orders (LITERAL) ALLOW * bob": "CREATE,WRITE",
+		"TOPIC orders (LITERAL) DENY * bob":  "READ",
+	} {
+		if bindings[key] != ops {
+			t.Errorf("%s = %q, want %q", key, bindings[key], ops)
+		}
+	}
+}
+
+func TestAclsCompareTopicFlag(t *testing.T) {
+	saved, savedTopics := acls_topic, topics
+	defer func() { acls_topic, topics = saved, savedTopics }()
+	if err := aclsCompareCmd.ParseFlags([]string{"-t", "topic1"}); err != nil {
+		t.Fatal(err)
+	}
+	if acls_topic != "topic1" || topics != savedTopics {
+		t.Errorf("acl compare -t sets acls_topic %q and topics %q, want only acls_topic", acls_topic, topics)
+	}
+}
@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Run a command and return its standard output.
+// All the kafka scripts are run through this variable, so that it can be replaced by a fake runner in tests.
+var runCommand = func(name string, args ...string) (string, error) {
+	return runKafkaCommand(true, name, args...)
+}
+
+// Run a command which changes the cluster (reset, delete, create, alter, election) : it is never retried,
+// since a timeout does not tell whether the change was applied
+var runMutatingCommand = func(name string, args ...string) (string, error) {
+	return runKafkaCommand(false, name, args...)
+}
+
+func runKafkaCommand(retry bool, name string, args ...string) (string, error) {
+	command := name + " " + strings.Join(args, " ")
+	if !retry && replayDir != "" { // a recording must not pass for a change of the cluster
+		return "", fmt.Errorf("%w : %s", errReplayMutating, command)
+	}
+	out, _, err := recorded("cmd "+command, func() (string, string, error) {
+		if !retry {
+			out, err := runCommandOnce(name, args...)
+			return out, "", err
+		}
+		var out string
+		err := withRetries(command, func() error {
+			var err error
+			out, err = runCommandOnce(name, args...)
+			return err
+		})
+		return out, "", err
+	}, commandError(command))
+	if err != nil {
+		recordError(bootstrapArg(args), err)
+		return "", err
+	}
+	return out, nil
+}
+
+func runCommandOnce(name string, args ...string) (string, error) {
+	command := name + " " + strings.Join(args, " ")
+	log.Debug("Run command : " + command)
+	ctx, cancel := commandContext()
+	defer cancel()
+	ecmd := exec.CommandContext(ctx, name, args...) // the process is killed when the context is done
+	var out, stderr bytes.Buffer
+	ecmd.Stdout = &out
+	ecmd.Stderr = &stderr
+	if err := ecmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return "", ctxErr(ctx, command, err)
+		}
+		return "", newKafkaError(command, stderr.String(), err)
+	}
+	if stderr.Len() > 0 {
+		log.Debug(command + " : " + stderr.String()) // JVM warnings and the like
+	}
+	return out.String(), nil
+}
+
+// Result of a task, along with the identity of its target
+type RESULT[T any] struct {
+	cluster, broker, topic string
+	value                  T
+	err                    error
+}
+
+// Collect the results of concurrent tasks; the results are merged in a deterministic order
+type COLLECTOR[T any] struct {
+	mu      sync.Mutex
+	results []RESULT[T]
+}
+
+func (c *COLLECTOR[T]) add(r RESULT[T]) {
+	c.mu.Lock()
+	c.results = append(c.results, r)
+	c.mu.Unlock()
+}
+
+// Return the results sorted by cluster, broker and topic
+func (c *COLLECTOR[T]) merge() []RESULT[T] {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	res := make([]RESULT[T], len(c.results))
+	copy(res, c.results)
+	sort.SliceStable(res, func(i, j int) bool {
+		if res[i].cluster != res[j].cluster {
+			return res[i].cluster < res[j].cluster
+		}
+		if res[i].broker != res[j].broker {
+			return res[i].broker < res[j].broker
+		}
+		return res[i].topic < res[j].topic
+	})
+	return res
+}
+
+// Return the values of the results without error, logging the errors
+func (c *COLLECTOR[T]) values() []T {
+	values := make([]T, 0)
+	for _, r := range c.merge() {
+		if r.err != nil {
+			log.Error(strings.TrimSpace(strings.Join([]string{r.cluster, r.broker, r.topic}, " ")) + " : " + r.err.Error())
+			continue
+		}
+		values = append(values, r.value)
+	}
+	return values
+}
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// Replace runCommand by a runner serving the given outputs, keyed by the command line
+func fakeRunner(t *testing.T, outputs map[string]string) {
+	t.Helper()
+	saved := runCommand
+	runCommand = func(name string, args ...string) (string, error) {
+		command := name + " " + strings.Join(args, " ")
+		out, exist := outputs[command]
+		if !exist {
+			return "", errors.New("unexpected command " + command)
+		}
+		return out, nil
+	}
+	t.Cleanup(func() { runCommand = saved })
+}
+
+// Serve the given recordings (e.g. "conn host:9092", "http http://host:50700/metrics") as with --replay
+func replayFixtures(t *testing.T, recordings map[string]string) {
+	t.Helper()
+	savedRecord, savedReplay := recordDir, replayDir
+	recordDir = t.TempDir()
+	for key, stdout := range recordings {
+		saveRecording(RECORDING{Key: key, Stdout: stdout})
+	}
+	replayDir, recordDir = recordDir, ""
+	t.Cleanup(func() { recordDir, replayDir = savedRecord, savedReplay })
+}
+
+func TestCollectorMergeIsDeterministic(t *testing.T) {
+	testScheduler(t, 4, 2)
+	outputs := make(map[string]string)
+	for c := 0; c < 3; c++ {
+		for b := 0; b < 4; b++ {
+			outputs[fmt.Sprintf("describe cluster%d broker%d", c, b)] = fmt.Sprintf("%d-%d", c, b)
+		}
+	}
+	fakeRunner(t, outputs)
+	var results COLLECTOR[string]
+	var tasks TASKS
+	for c := 2; c >= 0; c-- {
+		for b := 3; b >= 0; b-- {
+			cluster, broker := fmt.Sprintf("cluster%d", c), fmt.Sprintf("broker%d", b)
+			tasks.Go(cluster, func() {
+				out, err := runCommand("describe", cluster, broker)
+				results.add(RESULT[string]{cluster: cluster, broker: broker, value: out, err: err})
+			})
+		}
+	}
+	tasks.Wait()
+	merged := results.merge()
+	if len(merged) != 12 {
+		t.Fatalf("got %d results, want 12", len(merged))
+	}
+	for i, r := range merged {
+		if want := fmt.Sprintf("%d-%d", i/4, i%4); r.value != want || r.err != nil {
+			t.Errorf("result %d = %q (%v), want %q", i, r.value, r.err, want)
+		}
+	}
+}
+
+func TestCollectorValuesSkipErrors(t *testing.T) {
+	testScheduler(t, 4, 2)
+	fakeRunner(t, map[string]string{"list b": "topic-b", "list a": "topic-a"})
+	var results COLLECTOR[string]
+	var tasks TASKS
+	for _, cluster := range []string{"c", "b", "a"} {
+		cluster := cluster
+		tasks.Go(cluster, func() {
+			out, err := runCommand("list", cluster)
+			results.add(RESULT[string]{cluster: cluster, value: out, err: err})
+		})
+	}
+	tasks.Wait()
+	values := results.values()
+	if strings.Join(values, ",") != "topic-a,topic-b" {
+		t.Errorf("values = %v, want [topic-a topic-b]", values)
+	}
+}
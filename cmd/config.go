@@ -1,15 +1,12 @@
 package cmd
 
 import (
-	"bytes"
 	"errors"
 	"fmt"
-	"os/exec"
 	"sort"
 	"strconv"
 	"strings"
 
-	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
@@ -47,14 +44,7 @@ func config_cmd(servers string) (string, error) {
 	if err := check_conn(servers); err != nil {
 		return "", errors.New("No connection to the VMs\n" + err.Error())
 	}
-	log.Debug("Run command : kafka-configs.sh --bootstrap-server" + servers + " --describe --broker " + strconv.Itoa(config_broker) + " --all")
-	ecmd := exec.Command("kafka-configs.sh", "--bootstrap-server", servers, "--describe", "--broker", strconv.Itoa(config_broker), "--all")
-	var out bytes.Buffer
-	ecmd.Stdout = &out
-	if err := ecmd.Run(); err != nil {
-		return "", err
-	}
-	return out.String(), nil
+	return runCommand("kafka-configs.sh", "--bootstrap-server", servers, "--describe", "--broker", strconv.Itoa(config_broker), "--all")
 }
 
 type CONF struct {
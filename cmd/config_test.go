@@ -0,0 +1,15 @@
+package cmd
+
+import "testing"
+
+func TestExtractConfGolden(t *testing.T) {
+	replayTestdata(t)
+	out, err := config_cmd(fixtureBootstrap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := with_null
+	with_null = true
+	defer func() { with_null = saved }()
+	checkGolden(t, "config", config_toString(extractConf(out)))
+}
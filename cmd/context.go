@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var deadline, cmdTimeout time.Duration
+
+func init() {
+	rootCmd.PersistentFlags().DurationVarP(&deadline, "deadline", "", 0, "Maximum duration of the whole run (e.g. 2m); 0 means no deadline")
+	rootCmd.PersistentFlags().DurationVarP(&cmdTimeout, "cmd-timeout", "", 5*time.Minute, "Maximum duration of one command (kafka script, pod exec); 0 means no timeout")
+}
+
+// Context of the whole run : cancelled on Ctrl-C / SIGTERM, or when the deadline is reached
+var rootCtx = context.Background()
+var cancelRootCtx context.CancelFunc = func() {}
+
+var errTimeout = errors.New("TIMED OUT")
+var errCanceled = errors.New("CANCELED")
+
+func initContext() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	cancelRootCtx = stop
+	if deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, deadline)
+		cancelRootCtx = func() { cancel(); stop() }
+	}
+	rootCtx = ctx
+}
+
+// Context of one command : the run context, limited by the --cmd-timeout
+func commandContext() (context.Context, context.CancelFunc) {
+	if cmdTimeout > 0 {
+		return context.WithTimeout(rootCtx, cmdTimeout)
+	}
+	return context.WithCancel(rootCtx)
+}
+
+// Replace the error of a command by errTimeout or errCanceled when its context is done
+func ctxErr(ctx context.Context, what string, err error) error {
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return fmt.Errorf("%w : %s", errTimeout, what)
+	case errors.Is(ctx.Err(), context.Canceled):
+		return fmt.Errorf("%w : %s", errCanceled, what)
+	}
+	return err
+}
+
+func isTimeout(err error) bool {
+	return errors.Is(err, errTimeout) || errors.Is(err, errCanceled)
+}
+
+// Report the error of a cluster : the timed out clusters are displayed explicitly along with the results of the others
+func clusterError(cluster string, err error) {
+	if isTimeout(err) {
+		fmt.Printf("%s: %s\n", cluster, err)
+		return
+	}
+	log.Error(cluster + " " + err.Error())
+}
@@ -0,0 +1,201 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var retries int
+var retryBackoff time.Duration
+
+func init() {
+	rootCmd.PersistentFlags().IntVarP(&retries, "retries", "", 2, "Number of retries of a command failing with a transient error (connection refused, timeout, coordinator not available)")
+	rootCmd.PersistentFlags().DurationVarP(&retryBackoff, "retry-backoff", "", time.Second, "Wait before the first retry, doubled at each retry")
+	rootCmd.PersistentPostRun = func(cmd *cobra.Command, args []string) {
+		printErrorSummary()
+	}
+}
+
+// Kinds of errors reported by the kafka scripts
+const (
+	ERR_CONNECTION     = "connection refused"
+	ERR_AUTHENTICATION = "authentication failed"
+	ERR_AUTHORIZATION  = "authorization denied"
+	ERR_UNKNOWN_TOPIC  = "unknown topic"
+	ERR_UNKNOWN_GROUP  = "unknown group"
+	ERR_TIMEOUT        = "timeout"
+	ERR_COORDINATOR    = "coordinator not available"
+	ERR_OTHER          = "other"
+)
+
+// Patterns of the stderr of the kafka scripts, checked in order
+var errorPatterns = []struct {
+	kind string
+	re   *regexp.Regexp
+}{
+	{ERR_AUTHENTICATION, regexp.MustCompile(`(?i)(Sasl|Ssl)?AuthenticationException|Authentication failed`)},
+	{ERR_AUTHORIZATION, regexp.MustCompile(`(?i)AuthorizationException|Not authorized`)},
+	{ERR_UNKNOWN_TOPIC, regexp.MustCompile(`(?i)UnknownTopicOrPartitionException|Topic '.*' does not exist|Topics? .* (does|do) not exist`)},
+	{ERR_UNKNOWN_GROUP, regexp.MustCompile(`(?i)GroupIdNotFoundException|Consumer group .* does not exist`)},
+	{ERR_COORDINATOR, regexp.MustCompile(`(?i)CoordinatorNotAvailableException|NotCoordinatorException|COORDINATOR_NOT_AVAILABLE|coordinator is not available`)},
+	{ERR_CONNECTION, regexp.MustCompile(`(?i)Connection refused|could not be established|Broker may not be available|No connection to the VMs`)},
+	{ERR_TIMEOUT, regexp.MustCompile(`(?i)TimeoutException|Timed out waiting`)},
+}
+
+// Error of a command, classified from its stderr
+type KAFKAERROR struct {
+	kind, command, stderr string
+	err                   error
+}
+
+func (e *KAFKAERROR) Error() string {
+	return fmt.Sprintf("%s : %s (%s : %v)", e.kind, errorLine(e.stderr), e.command, e.err)
+}
+
+func (e *KAFKAERROR) Unwrap() error {
+	return e.err
+}
+
+// Only these errors are worth a retry
+func (e *KAFKAERROR) transient() bool {
+	return e.kind == ERR_CONNECTION || e.kind == ERR_TIMEOUT || e.kind == ERR_COORDINATOR
+}
+
+func newKafkaError(command, stderr string, err error) *KAFKAERROR {
+	return &KAFKAERROR{kind: classifyError(stderr + "\n" + err.Error()), command: command, stderr: stderr, err: err}
+}
+
+func classifyError(stderr string) string {
+	for _, p := range errorPatterns {
+		if p.re.MatchString(stderr) {
+			return p.kind
+		}
+	}
+	return ERR_OTHER
+}
+
+// The most meaningful line of the stderr : the first one with an exception or error, else the last one (JVM warnings come first)
+func errorLine(stderr string) string {
+	last := ""
+	for _, line := range strings.Split(stderr, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.Contains(line, "Exception") || strings.HasPrefix(line, "Error") {
+			return line
+		}
+		if line != "" {
+			last = line
+		}
+	}
+	return last
+}
+
+// Kind of any error returned by the commands
+func errorKind(err error) string {
+	var ke *KAFKAERROR
+	if errors.As(err, &ke) {
+		return ke.kind
+	}
+	if isTimeout(err) {
+		return ERR_TIMEOUT
+	}
+	return ERR_OTHER
+}
+
+// Run the function, and run it again with an exponential backoff while it fails with a transient error
+func withRetries(what string, f func() error) error {
+	backoff := retryBackoff
+	for i := 0; ; i++ {
+		err := f()
+		var ke *KAFKAERROR
+		if err == nil || i >= retries || !errors.As(err, &ke) || !ke.transient() {
+			return err
+		}
+		log.Warn(fmt.Sprintf("%s : %s, retry %d/%d in %s", what, ke.kind, i+1, retries, backoff))
+		select {
+		case <-rootCtx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// Errors of the run, per cluster and per kind
+var errorSummary = struct {
+	sync.Mutex
+	counts map[string]map[string]int
+	names  map[string]string // bootstrap servers => cluster name
+}{counts: make(map[string]map[string]int), names: make(map[string]string)}
+
+// Remember the names of the clusters, so that the errors of their bootstrap servers are reported with the cluster name
+func registerServers(servers []SERVER) {
+	errorSummary.Lock()
+	defer errorSummary.Unlock()
+	for _, s := range servers {
+		errorSummary.names[s.bootstrap] = s.cluster
+		if s.zookeepers != "" {
+			errorSummary.names[s.zookeepers] = s.cluster
+		}
+	}
+}
+
+// Count the error for the given cluster, bootstrap servers or namespace
+func recordError(key string, err error) {
+	errorSummary.Lock()
+	defer errorSummary.Unlock()
+	if name, exist := errorSummary.names[key]; exist {
+		key = name
+	}
+	if errorSummary.counts[key] == nil {
+		errorSummary.counts[key] = make(map[string]int)
+	}
+	errorSummary.counts[key][errorKind(err)]++
+}
+
+// Return the value of the --bootstrap-server argument of a kafka script (or the zookeepers of zookeeper-shell.sh)
+func bootstrapArg(args []string) string {
+	for i, a := range args {
+		if a == "--bootstrap-server" && i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	if len(args) > 0 {
+		return args[0]
+	}
+	return "-"
+}
+
+func printErrorSummary() {
+	errorSummary.Lock()
+	defer errorSummary.Unlock()
+	if len(errorSummary.counts) == 0 {
+		return
+	}
+	clusters := make([]string, 0)
+	for c := range errorSummary.counts {
+		clusters = append(clusters, c)
+	}
+	sort.Strings(clusters)
+	fmt.Fprintln(os.Stderr, "Errors:")
+	for _, c := range clusters {
+		kinds := make([]string, 0)
+		for k := range errorSummary.counts[c] {
+			kinds = append(kinds, k)
+		}
+		sort.Strings(kinds)
+		for i, k := range kinds {
+			kinds[i] = fmt.Sprintf("%d %s", errorSummary.counts[c][k], k)
+		}
+		fmt.Fprintf(os.Stderr, "  %s: %s\n", c, strings.Join(kinds, ", "))
+	}
+	errorSummary.counts = make(map[string]map[string]int) // the shell runs several commands
+}
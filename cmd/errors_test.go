@@ -0,0 +1,24 @@
+package cmd
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLogFatalPrintsErrorSummary(t *testing.T) {
+	saved := session
+	session = newSession()
+	defer func() { session = saved }()
+	recordError(fixtureBootstrap, errors.New("Connection to node -1 could not be established"))
+	defer func() {
+		if _, ok := recover().(SHELLABORT); !ok {
+			t.Error("logFatal did not abort the command")
+		}
+		errorSummary.Lock()
+		defer errorSummary.Unlock()
+		if len(errorSummary.counts) != 0 {
+			t.Errorf("errors left after logFatal : %v", errorSummary.counts)
+		}
+	}()
+	logFatal(errors.New("no cluster"))
+}
@@ -1,16 +1,12 @@
 package cmd
 
 import (
-	"bytes"
 	"errors"
 	"fmt"
-	"os/exec"
 	"regexp"
 	"sort"
 	"strings"
-	"sync"
 
-	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
@@ -59,103 +55,92 @@ func init() {
 }
 
 func group_describe(servers []SERVER) {
-	var wg sync.WaitGroup
+	var tasks TASKS
 	for i, s := range servers {
 		for j, g := range s.groups {
-			wg.Add(1)
-			go func(j int, g string, server *SERVER) {
+			j, g, server := j, g.name, &servers[i]
+			tasks.Go(server.bootstrap, func() {
 				desc, err := group_info_cmd(server.bootstrap, g, "")
 				if !logErr(err) {
 					for _, gd := range strings.Split(desc, "\n") {
 						server.groups[j].describe = append(server.groups[j].describe, gd)
 					}
 				}
-				wg.Done()
-			}(j, g.name, &servers[i])
+			})
 		}
 	}
-	wg.Wait()
+	tasks.Wait()
 }
 
 func group_members(servers []SERVER) {
-	var wg sync.WaitGroup
+	var tasks TASKS
 	for i, s := range servers {
 		for j, g := range s.groups {
-			wg.Add(1)
-			go func(j int, g string, server *SERVER) {
+			j, g, server := j, g.name, &servers[i]
+			tasks.Go(server.bootstrap, func() {
 				members, err := group_info_cmd(server.bootstrap, g, OPT_GROUP_MEMBERS)
 				if !logErr(err) {
 					for _, gm := range strings.Split(members, "\n") {
 						server.groups[j].members = append(server.groups[j].members, gm)
 					}
 				}
-				wg.Done()
-			}(j, g.name, &servers[i])
+			})
 		}
 	}
-	wg.Wait()
+	tasks.Wait()
 }
 
 func group_state(servers []SERVER) {
-	var wg sync.WaitGroup
+	var tasks TASKS
 	for i, s := range servers {
 		for j, g := range s.groups {
-			wg.Add(1)
-			go func(j int, g string, server *SERVER) {
+			j, g, server := j, g.name, &servers[i]
+			tasks.Go(server.bootstrap, func() {
 				st, err := group_info_cmd(server.bootstrap, g, OPT_GROUP_STATE)
 				if !logErr(err) {
 					server.groups[j].state = strings.Split(st, "\n")[2]
 				}
-				wg.Done()
-			}(j, g.name, &servers[i])
+			})
 		}
 	}
-	wg.Wait()
+	tasks.Wait()
 }
 
 func group_list(servers []SERVER) {
-	var wg sync.WaitGroup
+	var tasks TASKS
 	for i := range servers {
-		wg.Add(1)
-		go func(s *SERVER) {
+		s := &servers[i]
+		tasks.Go(s.bootstrap, func() {
 			groups, err := group_list_cmd(s.bootstrap)
-			if !logErr(err) {
+			if err != nil {
+				clusterError(s.cluster, err)
+			} else {
 				for _, g := range strings.Split(groups, "\n") {
-					s.groups = append(s.groups, GROUP{name: g})
+					if g = strings.TrimSpace(g); g != "" {
+						s.groups = append(s.groups, GROUP{name: g})
+					}
 				}
+				s.groups = selectGroups(s.groups)
 			}
-			wg.Done()
-		}(&servers[i])
+		})
 	}
-	wg.Wait()
+	tasks.Wait()
 }
 
 func group_list_cmd(servers string) (string, error) {
 	if err := check_conn(servers); err != nil {
 		return "", errors.New("No connection to the VMs\n" + err.Error())
 	}
-	log.Debug("Run command : kafka-consumer-groups.sh --bootstrap-server" + servers + " --list")
-	ecmd := exec.Command("kafka-consumer-groups.sh", "--bootstrap-server", servers, "--list")
-	var out bytes.Buffer
-	ecmd.Stdout = &out
-	if err := ecmd.Run(); err != nil {
-		return "", err
-	}
-	return out.String(), nil
+	return session.cachedList("groups", servers, func() (string, error) {
+		return runCommand("kafka-consumer-groups.sh", "--bootstrap-server", servers, "--list")
+	})
 }
 
 func group_info_cmd(servers, group, option string) (string, error) {
 	if err := check_conn(servers); err != nil {
 		return "", errors.New("No connection to the VMs\n" + err.Error())
 	}
-	log.Debug("Run command : kafka-consumer-groups.sh --bootstrap-server"+servers+" --describe", "--group", group, "--verbose", option)
-	ecmd := exec.Command("kafka-consumer-groups.sh", "--bootstrap-server", servers, "--describe", "--group", group, "--verbose", option)
-	var out bytes.Buffer
-	ecmd.Stdout = &out
-	if err := ecmd.Run(); err != nil {
-		return "", err
-	}
-	return out.String(), nil
+	return runCommand("kafka-consumer-groups.sh", "--bootstrap-server", servers, "--describe", "--group", group, "--verbose", option)
 }
 
 func sortGroups(a *[]GROUP) {
@@ -169,9 +154,13 @@ func sortGroups(a *[]GROUP) {
 }
 
 func printGroupsListAllServers(servers []SERVER) {
+	for _, state := range []string{"groups", "stable", "empty", "dead", "preparingrebalance", "completingrebalance"} {
+		addWatchMetric(state, 0)
+	}
 	for _, server := range servers {
 		fmt.Println(server.cluster)
 		printGroupList(server.groups)
+		addWatchMetric("groups", float64(len(server.groups)))
 	}
 }
 
@@ -194,6 +183,7 @@ func printGroupList(groups []GROUP) {
 					s4, s5, s6 = "-", ss[4], ss[5]
 				}
 				fmt.Printf("%-*s  %-*s (%2s)  %-19s  %-*s  %s\n", m0, ss[1], m1, ss[2], ss[3], s4, m2, s5, s6)
+				addWatchMetric(strings.ToLower(s5), 1)
 			}
 		}
 	}
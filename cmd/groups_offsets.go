@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// One line of kafka-consumer-groups.sh --describe : the committed offset of a group on a partition
+type OFFSET struct {
+	group, topic               string
+	partition                  int
+	current, logEnd, lag       int64 // -1 if unknown ("-")
+	reset                      int64 // NEW-OFFSET of --reset-offsets, -1 if none
+	consumerId, host, clientId string
+}
+
+// Describe the offsets of all the groups of a cluster
+func group_offsets_cmd(servers string) (string, error) {
+	if err := check_conn(servers); err != nil {
+		return "", errors.New("No connection to the VMs\n" + err.Error())
+	}
+	return runCommand("kafka-consumer-groups.sh", "--bootstrap-server", servers, "--describe", "--all-groups")
+}
+
+// State of all the groups of a cluster
+func group_states_cmd(servers string) (string, error) {
+	if err := check_conn(servers); err != nil {
+		return "", errors.New("No connection to the VMs\n" + err.Error())
+	}
+	return runCommand("kafka-consumer-groups.sh", "--bootstrap-server", servers, "--describe", "--all-groups", "--state")
+}
+
+// Parse the output of --describe --all-groups --state : the state of each group
+func parseGroupStates(out string) []GROUP {
+	res := make([]GROUP, 0)
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || fields[0] == "GROUP" || strings.HasPrefix(line, "[") {
+			continue
+		}
+		if state := groupStateOf(line); state != "" {
+			res = append(res, GROUP{name: fields[0], state: state})
+		}
+	}
+	return res
+}
+
+func toOffset(s string) int64 {
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return -1
+	}
+	return v
+}
+
+// Parse the output of kafka-consumer-groups.sh --describe (one or all groups) or --reset-offsets; the columns are found from the header lines
+func parseGroupOffsets(out string) []OFFSET {
+	res := make([]OFFSET, 0)
+	var header map[string]int
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(line, "[") {
+			continue
+		}
+		if fields[0] == "GROUP" {
+			header = make(map[string]int)
+			for i, f := range fields {
+				header[f] = i
+			}
+			continue
+		}
+		if header == nil || len(fields) < len(header) {
+			continue
+		}
+		get := func(col string) string {
+			if i, exist := header[col]; exist && i < len(fields) {
+				return fields[i]
+			}
+			return ""
+		}
+		p, err := strconv.Atoi(get("PARTITION"))
+		if err != nil {
+			continue
+		}
+		res = append(res, OFFSET{
+			group:      get("GROUP"),
+			topic:      get("TOPIC"),
+			partition:  p,
+			current:    toOffset(get("CURRENT-OFFSET")),
+			logEnd:     toOffset(get("LOG-END-OFFSET")),
+			lag:        toOffset(get("LAG")),
+			reset:      toOffset(get("NEW-OFFSET")),
+			consumerId: get("CONSUMER-ID"),
+			host:       get("HOST"),
+			clientId:   get("CLIENT-ID"),
+		})
+	}
+	return res
+}
+
+type GROUPLAG struct {
+	Group string
+	Lag   int64
+}
+
+// Sum the lag of each group, sorted by decreasing lag
+func groupLags(offsets []OFFSET) []GROUPLAG {
+	m := make(map[string]int64)
+	for _, o := range offsets {
+		if o.lag > 0 {
+			m[o.group] += o.lag
+		} else if _, exist := m[o.group]; !exist {
+			m[o.group] = 0
+		}
+	}
+	res := make([]GROUPLAG, 0, len(m))
+	for g, l := range m {
+		res = append(res, GROUPLAG{Group: g, Lag: l})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Lag == res[j].Lag {
+			return res[i].Group < res[j].Group
+		}
+		return res[i].Lag > res[j].Lag
+	})
+	return res
+}
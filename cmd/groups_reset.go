@@ -0,0 +1,343 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// Represent the group reset command
+var groupResetCmd = &cobra.Command{
+	Use:   "reset",
+	Short: "[ERDING] Reset the offsets of consumer groups, after a dry-run showing the new offsets",
+	Long: `Run kafka-consumer-groups.sh --reset-offsets in dry-run for the given groups (and topics, else all their topics)
+  and display for each partition the current and the new offset, with the number of messages to consume again (negative delta)
+  or to skip (positive delta). With --execute, the offsets are reset after confirmation, only for the groups which are Empty.
+	e.g. go run kstat.go -c bkt28 -g group1 -t topic1 group reset --to-datetime 2024-05-01T08:00:00
+	e.g. go run kstat.go -c bkt28 -g group1 group reset --shift-by -1000 --execute `,
+
+	Run: func(cmd *cobra.Command, args []string) {
+		groupReset(cmd, false)
+	},
+}
+
+// Represent the kgroup reset command, the same in a kafka pod of the namespaces given with --ns
+var kGroupResetCmd = &cobra.Command{
+	Use:   "reset",
+	Short: "[PaaS] Reset the offsets of consumer groups inside a PaaS, after a dry-run showing the new offsets",
+	Long: `The same as group reset, in a kafka pod of the namespaces given with --ns.
+	e.g. go run kstat.go --ns kafka-xxx -g group1 kgroup reset --to-latest `,
+
+	Run: func(cmd *cobra.Command, args []string) {
+		groupReset(cmd, true)
+	},
+}
+
+func groupReset(cmd *cobra.Command, paas bool) {
+	scenario, err := resetScenario(cmd)
+	logFatal(err)
+	if strings.TrimSpace(groups) == "" {
+		logFatal(errors.New("No group defined : please use the --group command line option"))
+	}
+	targets, err := groupTargets(paas)
+	logFatal(err)
+	groupList := strings.Split(groups, ",")
+	plans := make([][]RESETPLAN, len(targets))
+	for i := range targets { // allocated before the tasks, which fill them
+		plans[i] = make([]RESETPLAN, len(groupList))
+	}
+	var tasks TASKS
+	for i, t := range targets {
+		for j, g := range groupList {
+			i, j, t, g := i, j, t, strings.TrimSpace(g)
+			tasks.Go(t.key, func() {
+				plans[i][j] = planReset(t, g, scenario)
+			})
+		}
+	}
+	tasks.Wait()
+	nChanges := 0
+	for i, t := range targets {
+		for _, p := range plans[i] {
+			fmt.Print(p.String(t.name))
+			nChanges += p.changes()
+		}
+	}
+	if !reset_execute || nChanges == 0 {
+		fmt.Printf("%d partition offset(s) to reset (dry-run)\n", nChanges)
+		return
+	}
+	if !askConfirmation(fmt.Sprintf("Reset %d partition offset(s)?", nChanges)) {
+		fmt.Println("Nothing reset")
+		return
+	}
+	for i, t := range targets {
+		for _, p := range plans[i] {
+			if p.changes() == 0 {
+				continue
+			}
+			out, err := executeReset(t, p.group, scenario)
+			if logErr(err) {
+				continue
+			}
+			fmt.Printf("%s: group %s reset, %d partition(s)\n", t.name, p.group, len(parseGroupOffsets(out)))
+		}
+	}
+}
+
+const CONSUMER_GROUPS = "kafka-consumer-groups.sh"
+
+var reset_toDatetime string
+var reset_toEarliest, reset_toLatest, reset_execute bool
+var reset_shiftBy, reset_toOffset int64
+
+func init() {
+	groupCmd.AddCommand(groupResetCmd)
+	kGroupCmd.AddCommand(kGroupResetCmd)
+	for _, c := range []*cobra.Command{groupResetCmd, kGroupResetCmd} {
+		c.Flags().StringVarP(&reset_toDatetime, "to-datetime", "", "", "Reset to the first offset after this date (YYYY-MM-DDTHH:mm:SS[.sss][timezone])")
+		c.Flags().BoolVarP(&reset_toEarliest, "to-earliest", "", false, "Reset to the earliest offset")
+		c.Flags().BoolVarP(&reset_toLatest, "to-latest", "", false, "Reset to the latest offset")
+		c.Flags().Int64VarP(&reset_shiftBy, "shift-by", "", 0, "Shift the current offsets by this number of messages (negative to consume again)")
+		c.Flags().Int64VarP(&reset_toOffset, "to-offset", "", 0, "Reset to this offset")
+		c.Flags().BoolVarP(&reset_execute, "execute", "", false, "Really reset the offsets (after confirmation, only for the Empty groups)")
+	}
+}
+
+// Where the kafka scripts run : a cluster, or a kafka pod of a PaaS namespace
+type GROUPTARGET struct {
+	name   string
+	key    string // the scheduler key of the cluster: the bootstrap, or the namespace for k8s
+	run    func(script string, args ...string) (string, error)
+	mutate func(script string, args ...string) (string, error) // the same without retries, for the changes
+}
+
+// The dry-run of the reset of a group
+type RESETPLAN struct {
+	group, state string
+	offsets      []OFFSET // current and reset (new) offsets per partition
+	err          error
+}
+
+// The kafka-consumer-groups.sh options of the scenario given on the command line
+func resetScenario(cmd *cobra.Command) ([]string, error) {
+	scenarios := make([][]string, 0)
+	if reset_toDatetime != "" {
+		dt, err := resetDatetime(reset_toDatetime)
+		if err != nil {
+			return nil, err
+		}
+		scenarios = append(scenarios, []string{"--to-datetime", dt})
+	}
+	if reset_toEarliest {
+		scenarios = append(scenarios, []string{"--to-earliest"})
+	}
+	if reset_toLatest {
+		scenarios = append(scenarios, []string{"--to-latest"})
+	}
+	if cmd.Flags().Changed("shift-by") {
+		scenarios = append(scenarios, []string{"--shift-by", strconv.FormatInt(reset_shiftBy, 10)})
+	}
+	if cmd.Flags().Changed("to-offset") {
+		scenarios = append(scenarios, []string{"--to-offset", strconv.FormatInt(reset_toOffset, 10)})
+	}
+	if len(scenarios) != 1 {
+		return nil, errors.New("Exactly one of --to-datetime, --to-earliest, --to-latest, --shift-by or --to-offset is needed")
+	}
+	return scenarios[0], nil
+}
+
+// Check the date, adding the milliseconds required by kafka-consumer-groups.sh if missing
+func resetDatetime(dt string) (string, error) {
+	re := regexp.MustCompile(`^(\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2})(\.\d{3})?(Z|[+-]\d{2}:?\d{2})?$`)
+	as := re.FindStringSubmatch(dt)
+	if len(as) != 4 {
+		return "", errors.New("Bad --to-datetime " + dt + " : should be like 2024-05-01T08:00:00.000")
+	}
+	if as[2] == "" {
+		as[2] = ".000"
+	}
+	return as[1] + as[2] + as[3], nil
+}
+
+// The clusters of the command line, or the namespaces of --ns for the k-commands
+func groupTargets(paas bool) ([]GROUPTARGET, error) {
+	targets := make([]GROUPTARGET, 0)
+	if !paas {
+		servers, err := initServers()
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range servers {
+			bootstrap := s.bootstrap
+			runner := func(run func(string, ...string) (string, error)) func(string, ...string) (string, error) {
+				return func(script string, args ...string) (string, error) {
+					if err := check_conn(bootstrap); err != nil {
+						return "", errors.New("No connection to the VMs\n" + err.Error())
+					}
+					return run(script, append([]string{"--bootstrap-server", bootstrap}, args...)...)
+				}
+			}
+			targets = append(targets, GROUPTARGET{name: s.cluster, key: bootstrap, run: runner(runCommand), mutate: runner(runMutatingCommand)})
+		}
+		return targets, nil
+	}
+	if namespace == "" {
+		return nil, errors.New("No namespace defined : please use the --ns command line option")
+	}
+	getClientsetOrDie()
+	getKafkaNs(strings.Split(namespace, ","))
+	getPodsAllNs()
+	for _, n := range Namespaces {
+		pod, err := n.kafkaBrokerPod()
+		if logErr(err) {
+			continue
+		}
+		ns := n.Name()
+		runner := func(exec func(string, string, string, string, io.Reader) (string, string, error)) func(string, ...string) (string, error) {
+			return func(script string, args ...string) (string, error) {
+				command := "bin/" + script + " --bootstrap-server localhost:9092 " + strings.Join(args, " ")
+				stdout, _, err := exec(command, "kafka", pod, ns, nil)
+				return stdout, err
+			}
+		}
+		targets = append(targets, GROUPTARGET{name: ns, key: ns, run: runner(execToPod), mutate: runner(execMutatingToPod)})
+	}
+	return targets, nil
+}
+
+// Arguments of kafka-consumer-groups.sh --reset-offsets; mode is --dry-run or --execute
+func resetArgs(group string, scenario []string, mode string) []string {
+	args := []string{"--reset-offsets", "--group", group}
+	if strings.TrimSpace(topics) == "" {
+		args = append(args, "--all-topics")
+	} else {
+		for _, t := range strings.Split(topics, ",") {
+			args = append(args, "--topic", strings.TrimSpace(t))
+		}
+	}
+	return append(append(args, scenario...), mode)
+}
+
+// State of the group from the output of --describe --state (e.g. Empty, Stable), "" if not found
+func groupStateOf(out string) string {
+	for _, line := range strings.Split(out, "\n") {
+		for _, f := range strings.Fields(line) {
+			if inArray([]string{"Stable", "Empty", "Dead", "PreparingRebalance", "CompletingRebalance"}, f) {
+				return f
+			}
+		}
+	}
+	return ""
+}
+
+// Get the state, the current offsets and the new offsets (dry-run) of the group
+func planReset(t GROUPTARGET, group string, scenario []string) RESETPLAN {
+	p := RESETPLAN{group: group}
+	out, err := t.run(CONSUMER_GROUPS, "--describe", "--group", group, "--state")
+	if err != nil {
+		p.err = err
+		return p
+	}
+	p.state = groupStateOf(out)
+	out, err = t.run(CONSUMER_GROUPS, "--describe", "--group", group)
+	if err != nil {
+		p.err = err
+		return p
+	}
+	current := make(map[string]OFFSET)
+	for _, o := range parseGroupOffsets(out) {
+		current[fmt.Sprintf("%s-%d", o.topic, o.partition)] = o
+	}
+	out, err = t.run(CONSUMER_GROUPS, resetArgs(group, scenario, "--dry-run")...)
+	if err != nil {
+		p.err = err
+		return p
+	}
+	for _, o := range parseGroupOffsets(out) {
+		c, exist := current[fmt.Sprintf("%s-%d", o.topic, o.partition)]
+		if !exist {
+			c = OFFSET{group: group, topic: o.topic, partition: o.partition, current: -1, logEnd: -1, lag: -1}
+		}
+		c.reset = o.reset
+		p.offsets = append(p.offsets, c)
+	}
+	sort.Slice(p.offsets, func(i, j int) bool {
+		if p.offsets[i].topic == p.offsets[j].topic {
+			return p.offsets[i].partition < p.offsets[j].partition
+		}
+		return p.offsets[i].topic < p.offsets[j].topic
+	})
+	return p
+}
+
+// Number of partitions whose offset changes
+func (p RESETPLAN) changes() int {
+	n := 0
+	for _, o := range p.offsets {
+		if o.reset >= 0 && o.reset != o.current {
+			n++
+		}
+	}
+	return n
+}
+
+func (p RESETPLAN) String(target string) string {
+	state := p.state
+	if state == "" {
+		state = "unknown state"
+	}
+	s := fmt.Sprintf("%s: group %s (%s)\n", target, p.group, state)
+	if p.err != nil {
+		return s + "  error : " + p.err.Error() + "\n"
+	}
+	maxL := len("TOPIC")
+	for _, o := range p.offsets {
+		maxL = max(maxL, len(o.topic))
+	}
+	s += fmt.Sprintf("  %-*s  %9s  %12s  %12s  %12s  %12s\n", maxL, "TOPIC", "PARTITION", "CURRENT", "NEW", "DELTA", "LOG-END")
+	var again, skipped int64
+	for _, o := range p.offsets {
+		delta := "-"
+		if o.current >= 0 && o.reset >= 0 {
+			d := o.reset - o.current
+			delta = fmt.Sprintf("%+d", d)
+			if d < 0 {
+				again -= d
+			} else {
+				skipped += d
+			}
+		}
+		s += fmt.Sprintf("  %-*s  %9d  %12s  %12s  %12s  %12s\n", maxL, o.topic, o.partition, offsetString(o.current), offsetString(o.reset), delta, offsetString(o.logEnd))
+	}
+	s += fmt.Sprintf("  %d partition(s) to reset : %d message(s) to consume again, %d message(s) to skip\n", p.changes(), again, skipped)
+	if reset_execute && p.changes() > 0 && p.state != "Empty" {
+		s += "  the group must be Empty to be reset : stop its consumers first\n"
+	}
+	return s
+}
+
+func offsetString(o int64) string {
+	if o < 0 {
+		return "-"
+	}
+	return strconv.FormatInt(o, 10)
+}
+
+// Reset the offsets of the group, checking again that it is Empty
+func executeReset(t GROUPTARGET, group string, scenario []string) (string, error) {
+	out, err := t.run(CONSUMER_GROUPS, "--describe", "--group", group, "--state")
+	if err != nil {
+		return "", err
+	}
+	if state := groupStateOf(out); state != "Empty" {
+		return "", errors.New(t.name + ": group " + group + " not reset, its state is " + state + " instead of Empty")
+	}
+	return t.mutate(CONSUMER_GROUPS, resetArgs(group, scenario, "--execute")...)
+}
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// A target serving the given outputs, keyed by the arguments of kafka-consumer-groups.sh
+func fakeGroupTarget(outputs map[string]string) GROUPTARGET {
+	run := func(script string, args ...string) (string, error) {
+		out, exist := outputs[strings.Join(args, " ")]
+		if !exist {
+			return "", errors.New("unexpected command " + script + " " + strings.Join(args, " "))
+		}
+		return out, nil
+	}
+	return GROUPTARGET{name: "bkt28", key: fixtureBootstrap, run: run, mutate: run}
+}
+
+func TestPlanReset(t *testing.T) {
+	saved := topics
+	topics = ""
+	defer func() { topics = saved }()
+	target := fakeGroupTarget(map[string]string{
+		"--describe --group group1 --state": "GROUP   COORDINATOR (ID)          ASSIGNMENT-STRATEGY  STATE  #MEMBERS\n" +
+			"group1  bk1.example.net:9092 (1)                      Empty  0\n",
+		"--describe --group group1": "GROUP   TOPIC   PARTITION  CURRENT-OFFSET  LOG-END-OFFSET  LAG  CONSUMER-ID  HOST  CLIENT-ID\n" +
+			"group1  orders  1          200             250             50   -            -     -\n" +
+			"group1  orders  0          100             100             0    -            -     -\n",
+		"--reset-offsets --group group1 --all-topics --shift-by -20 --dry-run": "GROUP   TOPIC   PARTITION  NEW-OFFSET\n" +
+			"group1  orders  0          80\n" +
+			"group1  orders  1          180\n" +
+			"group1  orders  2          0\n",
+	})
+	p := planReset(target, "group1", []string{"--shift-by", "-20"})
+	if p.err != nil {
+		t.Fatal(p.err)
+	}
+	if p.state != "Empty" || p.changes() != 3 {
+		t.Errorf("state %s, %d change(s), want Empty and 3", p.state, p.changes())
+	}
+	want := "bkt28: group group1 (Empty)\n" +
+		"  TOPIC   PARTITION       CURRENT           NEW         DELTA       LOG-END\n" +
+		"  orders          0           100            80           -20           100\n" +
+		"  orders          1           200           180           -20           250\n" +
+		"  orders          2             -             0             -             -\n" +
+		"  3 partition(s) to reset : 40 message(s) to consume again, 0 message(s) to skip\n"
+	if got := p.String(target.name); got != want {
+		t.Errorf("plan =\n%s\nwant\n%s", got, want)
+	}
+	p = planReset(target, "group2", []string{"--to-latest"})
+	if p.err == nil || !strings.Contains(p.String(target.name), "error : unexpected command") {
+		t.Errorf("plan of an unknown group = %q", p.String(target.name))
+	}
+}
+
+func TestResetDatetime(t *testing.T) {
+	for dt, want := range map[string]string{
+		"2024-05-01T08:00:00":           "2024-05-01T08:00:00.000",
+		"2024-05-01T08:00:00.123":       "2024-05-01T08:00:00.123",
+		"2024-05-01T08:00:00Z":          "2024-05-01T08:00:00.000Z",
+		"2024-05-01T08:00:00.5+02:00":   "",
+		"2024-05-01T08:00:00.500+02:00": "2024-05-01T08:00:00.500+02:00",
+		"2024-05-01 08:00":              "",
+	} {
+		got, err := resetDatetime(dt)
+		if want == "" {
+			if err == nil {
+				t.Errorf("%s = %s, want an error", dt, got)
+			}
+		} else if got != want || err != nil {
+			t.Errorf("%s = %s, %v, want %s", dt, got, err, want)
+		}
+	}
+}
@@ -0,0 +1,346 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/spf13/cobra"
+)
+
+// Represent the group stale command
+var groupStaleCmd = &cobra.Command{
+	Use:   "stale",
+	Short: "[ERDING] Report the Empty and Dead groups, by how long their offsets are unchanged, and delete them",
+	Long: `List the groups which are Empty or Dead, grouped by how long their committed offsets have been unchanged,
+  along with the topics of their offsets which no longer exist. The age comes from a snapshot of the offsets of all groups,
+  kept in --snapshot-dir and updated at each run : the first run only records the offsets.
+  With --delete, the stale groups unchanged for at least --min-age are deleted after confirmation.
+	e.g. go run kstat.go --git-branch ERDING_TL1 group stale
+	e.g. go run kstat.go -c bkt28 --include "test-*" group stale --delete --min-age 720h `,
+
+	Run: func(cmd *cobra.Command, args []string) {
+		groupStale(false)
+	},
+}
+
+// Represent the kgroup stale command, the same in a kafka pod of the namespaces given with --ns
+var kGroupStaleCmd = &cobra.Command{
+	Use:   "stale",
+	Short: "[PaaS] Report the Empty and Dead groups inside a PaaS, by how long their offsets are unchanged, and delete them",
+	Long: `The same as group stale, in a kafka pod of the namespaces given with --ns.
+	e.g. go run kstat.go --ns kafka-xxx kgroup stale `,
+
+	Run: func(cmd *cobra.Command, args []string) {
+		groupStale(true)
+	},
+}
+
+func groupStale(paas bool) {
+	targets, err := groupTargets(paas)
+	logFatal(err)
+	reports := make([]STALEREPORT, len(targets))
+	var tasks TASKS
+	for i, t := range targets {
+		i, t := i, t
+		tasks.Go(t.key, func() {
+			reports[i] = staleReport(t, time.Now())
+		})
+	}
+	tasks.Wait()
+	candidates := 0
+	for _, r := range reports {
+		fmt.Print(r.String())
+		candidates += len(r.deletable())
+	}
+	if !stale_delete || candidates == 0 {
+		if stale_delete {
+			fmt.Printf("No group unchanged for at least %s to delete\n", stale_minAge)
+		}
+		return
+	}
+	if !askConfirmation(fmt.Sprintf("Delete %d group(s) unchanged for at least %s?", candidates, stale_minAge)) {
+		fmt.Println("Nothing deleted")
+		return
+	}
+	for i, t := range targets {
+		for _, batch := range batches(reports[i].deletable(), 50) {
+			args := []string{"--delete"}
+			for _, g := range batch {
+				args = append(args, "--group", g)
+			}
+			out, err := t.mutate(CONSUMER_GROUPS, args...)
+			if logErr(err) {
+				continue
+			}
+			fmt.Print(out)
+		}
+	}
+}
+
+var stale_snapshotDir string
+var stale_delete bool
+var stale_minAge time.Duration
+
+func init() {
+	groupCmd.AddCommand(groupStaleCmd)
+	kGroupCmd.AddCommand(kGroupStaleCmd)
+	for _, c := range []*cobra.Command{groupStaleCmd, kGroupStaleCmd} {
+		c.Flags().StringVarP(&stale_snapshotDir, "snapshot-dir", "", "", "Directory of the snapshots of the group offsets (default $HOME/.kstat_groups)")
+		c.Flags().BoolVarP(&stale_delete, "delete", "", false, "Delete the stale groups unchanged for at least --min-age (after confirmation)")
+		c.Flags().DurationVarP(&stale_minAge, "min-age", "", 30*24*time.Hour, "With --delete, minimum time since the offsets of a group last changed")
+	}
+}
+
+// The committed offsets of a group, and since when they are unchanged
+type GROUPSNAPSHOT struct {
+	Offsets string    `json:"offsets"` // e.g. topic1-0:100,topic1-1:200
+	Since   time.Time `json:"since"`
+}
+
+// A group which is Empty or Dead
+type STALEGROUP struct {
+	name, state   string
+	age           time.Duration // since the offsets last changed
+	known         bool          // in the snapshot of a previous run
+	deletedTopics []string      // topics of the offsets which no longer exist
+	topics        int           // number of topics of the offsets
+}
+
+type STALEREPORT struct {
+	target string
+	groups int // all the groups
+	stale  []STALEGROUP
+	err    error
+}
+
+// Age buckets of the report, the last one being the groups whose offsets are not known from a previous run
+var staleBuckets = []struct {
+	name string
+	min  time.Duration
+}{
+	{"unchanged for more than 90 days", 90 * 24 * time.Hour},
+	{"unchanged for 30 to 90 days", 30 * 24 * time.Hour},
+	{"unchanged for 7 to 30 days", 7 * 24 * time.Hour},
+	{"unchanged for 1 to 7 days", 24 * time.Hour},
+	{"unchanged for less than 1 day", 0},
+	{"not in a previous snapshot", -1},
+}
+
+func snapshotFile(target string) (string, error) {
+	dir := stale_snapshotDir
+	if dir == "" {
+		home, err := homedir.Dir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".kstat_groups")
+	}
+	return filepath.Join(dir, regexp.MustCompile(`[^A-Za-z0-9._-]+`).ReplaceAllString(target, "_")+".json"), nil
+}
+
+func loadSnapshot(target string) (map[string]GROUPSNAPSHOT, error) {
+	snap := make(map[string]GROUPSNAPSHOT)
+	file, err := snapshotFile(target)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return snap, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, &snap)
+	return snap, err
+}
+
+func saveSnapshot(target string, snap map[string]GROUPSNAPSHOT) error {
+	file, err := snapshotFile(target)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, data, 0644)
+}
+
+// The committed offsets of each group, in a stable form
+func offsetsPerGroup(offsets []OFFSET) map[string]string {
+	per := make(map[string][]string)
+	for _, o := range offsets {
+		per[o.group] = append(per[o.group], fmt.Sprintf("%s-%d:%d", o.topic, o.partition, o.current))
+	}
+	res := make(map[string]string)
+	for g, parts := range per {
+		sort.Strings(parts)
+		res[g] = strings.Join(parts, ",")
+	}
+	return res
+}
+
+// Find the stale groups of the target and update its snapshot
+func staleReport(t GROUPTARGET, now time.Time) STALEREPORT {
+	r := STALEREPORT{target: t.name}
+	out, err := t.run(CONSUMER_GROUPS, "--describe", "--all-groups", "--state")
+	if err != nil {
+		r.err = err
+		return r
+	}
+	all := parseGroupStates(out)
+	states := selectGroups(all)
+	r.groups = len(states)
+	out, err = t.run(CONSUMER_GROUPS, "--describe", "--all-groups")
+	if err != nil {
+		r.err = err
+		return r
+	}
+	offsets := parseGroupOffsets(out)
+	out, err = t.run("kafka-topics.sh", "--list")
+	if err != nil {
+		r.err = err
+		return r
+	}
+	existing := make(map[string]bool)
+	for _, tp := range strings.Split(out, "\n") {
+		existing[strings.TrimSpace(tp)] = true
+	}
+	snap, err := loadSnapshot(t.name)
+	if err != nil {
+		r.err = err
+		return r
+	}
+	current := offsetsPerGroup(offsets)
+	for _, g := range all { // the groups without committed offsets
+		if _, exist := current[g.name]; !exist {
+			current[g.name] = ""
+		}
+	}
+	next := make(map[string]GROUPSNAPSHOT)
+	for g, o := range current {
+		if prev, exist := snap[g]; exist && prev.Offsets == o {
+			next[g] = prev
+		} else {
+			next[g] = GROUPSNAPSHOT{Offsets: o, Since: now}
+		}
+	}
+	topicsOf := make(map[string]map[string]bool)
+	for _, o := range offsets {
+		if topicsOf[o.group] == nil {
+			topicsOf[o.group] = make(map[string]bool)
+		}
+		topicsOf[o.group][o.topic] = true
+	}
+	for _, g := range states {
+		if g.state != "Empty" && g.state != "Dead" {
+			continue
+		}
+		sg := STALEGROUP{name: g.name, state: g.state, topics: len(topicsOf[g.name])}
+		_, sg.known = snap[g.name]
+		sg.age = now.Sub(next[g.name].Since)
+		for tp := range topicsOf[g.name] {
+			if !existing[tp] {
+				sg.deletedTopics = append(sg.deletedTopics, tp)
+			}
+		}
+		sort.Strings(sg.deletedTopics)
+		r.stale = append(r.stale, sg)
+	}
+	sort.Slice(r.stale, func(i, j int) bool {
+		if r.stale[i].age == r.stale[j].age {
+			return r.stale[i].name < r.stale[j].name
+		}
+		return r.stale[i].age > r.stale[j].age
+	})
+	r.err = saveSnapshot(t.name, next)
+	return r
+}
+
+// The stale groups unchanged for at least --min-age
+func (r STALEREPORT) deletable() []string {
+	res := make([]string, 0)
+	for _, g := range r.stale {
+		if g.known && g.age >= stale_minAge {
+			res = append(res, g.name)
+		}
+	}
+	return res
+}
+
+func (r STALEREPORT) String() string {
+	if r.err != nil && r.groups == 0 {
+		return fmt.Sprintf("%s: error : %s\n", r.target, r.err.Error())
+	}
+	s := fmt.Sprintf("%s: %d group(s), %d Empty or Dead\n", r.target, r.groups, len(r.stale))
+	if r.err != nil {
+		s += "  snapshot not saved : " + r.err.Error() + "\n"
+	}
+	maxL := 0
+	for _, g := range r.stale {
+		maxL = max(maxL, len(g.name))
+	}
+	for i, b := range staleBuckets {
+		gs := make([]STALEGROUP, 0)
+		for _, g := range r.stale {
+			if bucketOf(g) == i {
+				gs = append(gs, g)
+			}
+		}
+		if len(gs) == 0 {
+			continue
+		}
+		s += fmt.Sprintf("  %s : %d\n", b.name, len(gs))
+		if short {
+			continue
+		}
+		for _, g := range gs {
+			deleted := ""
+			switch {
+			case g.topics > 0 && len(g.deletedTopics) == g.topics:
+				deleted = "all topics deleted"
+			case len(g.deletedTopics) > 0:
+				deleted = "deleted topics : " + strings.Join(g.deletedTopics, ",")
+			}
+			s += fmt.Sprintf("    %-*s  %-5s  %s\n", maxL, g.name, g.state, deleted)
+		}
+	}
+	return s
+}
+
+// Index of the bucket of the group
+func bucketOf(g STALEGROUP) int {
+	if g.known {
+		for i, b := range staleBuckets {
+			if b.min >= 0 && g.age >= b.min {
+				return i
+			}
+		}
+	}
+	return len(staleBuckets) - 1
+}
+
+// Split the names in batches of at most n
+func batches(names []string, n int) [][]string {
+	res := make([][]string, 0)
+	for len(names) > n {
+		res = append(res, names[:n])
+		names = names[n:]
+	}
+	if len(names) > 0 {
+		res = append(res, names)
+	}
+	return res
+}
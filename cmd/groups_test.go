@@ -0,0 +1,12 @@
+package cmd
+
+import "testing"
+
+func TestPrintGroupListGolden(t *testing.T) {
+	testScheduler(t, 4, 2)
+	replayTestdata(t)
+	servers := []SERVER{{cluster: "cluster1", bootstrap: fixtureBootstrap}}
+	group_list(servers)
+	group_state(servers)
+	checkGolden(t, "groups", captureStdout(t, func() { printGroupList(servers[0].groups) }))
+}
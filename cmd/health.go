@@ -1,13 +1,10 @@
 package cmd
 
 import (
-	"bytes"
 	"fmt"
-	"os/exec"
 	"strings"
 	"sync"
 
-	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
@@ -26,7 +23,11 @@ var healthCmd = &cobra.Command{
 	Note : if no option is selected (like --urp or --umisr), then all options will be checked.
 	e.g. go run kstat.go --git-branch ERDING_DEV --git-login jimbert --short health
 	You may as well reference the bootstrap servers from the git branch:
-	e.g. go run kstat.go --git-branch ERDING_DEV --git-login jimbert --short --cluster bkt28 health `,
+	e.g. go run kstat.go --git-branch ERDING_DEV --git-login jimbert --short --cluster bkt28 health
+	With --quorum, display the active controller and the zookeeper ensemble state (ruok/srvr/mntr on zk_servers),
+	or the KRaft quorum (kafka-metadata-quorum.sh) when the cluster has no zookeeper
+	With --brokers, compare the brokers of the inventory with the ones registered in the cluster (missing, unexpected and unreachable brokers)
+	e.g. go run kstat.go --git-branch ERDING_DEV --git-login jimbert health --brokers `,
 
 	Run: func(cmd *cobra.Command, args []string) {
 		servers, err := initServers()
@@ -35,7 +36,7 @@ var healthCmd = &cobra.Command{
 	},
 }
 
-var bURP, bUMISR, bUAV, bAMISR bool
+var bURP, bUMISR, bUAV, bAMISR, bBrokers, bQuorum bool
 
 func init() {
 	rootCmd.AddCommand(healthCmd)
@@ -44,70 +45,100 @@ func init() {
 	healthCmd.Flags().BoolVarP(&bUMISR, "umisr", "", false, "Look only for under min in sync partitions")
 	healthCmd.Flags().BoolVarP(&bAMISR, "amisr", "", false, "Look only for at min in sync partitions")
 	healthCmd.Flags().BoolVarP(&bUAV, "uav", "", false, "Look only for partitions whose leader is unavailable")
+	healthCmd.Flags().BoolVarP(&bQuorum, "quorum", "", false, "Look for the active controller and the zookeeper ensemble (or the KRaft quorum)")
+	healthCmd.Flags().BoolVarP(&bBrokers, "brokers", "", false, "Look for missing, unexpected and unreachable brokers compared to the inventory, and for brokers registered with another id than their broker_id")
 }
 
 func checkServersHealth(servers []SERVER) {
 	var wg sync.WaitGroup
+	var tasks TASKS
 	for _, s := range servers {
+		s := s
+		if bBrokers {
+			tasks.Go(s.bootstrap, func() {
+				checkServerBrokers(s)
+			})
+		}
+		if bQuorum {
+			tasks.Go(s.bootstrap, func() {
+				checkServerQuorum(s)
+			})
+		}
+		if (bBrokers || bQuorum) && !bURP && !bUMISR && !bAMISR && !bUAV { // only the brokers/quorum checks
+			continue
+		}
 		wg.Add(1)
-		go func(c, s string) {
+		go func(c, s string) { // collectHealth schedules its own tasks
 			checkBrokerHealth(c, s)
 			wg.Done()
 		}(s.cluster, s.bootstrap)
 	}
+	tasks.Wait()
 	wg.Wait()
 }
 
+// Result of the URP, UMISR, AMISR and UNAV checks of a cluster
+type HEALTH struct {
+	nURP, nUMISR, nAMISR, nUNAV         int
+	resURP, resUMISR, resAMISR, resUNAV string
+}
+
 // Check the URP, UMISR, AMISR and UNAV for the given broker
 func checkBrokerHealth(cluster, server string) {
-	if err := check_conn(server); err != nil {
-		log.Error(server + " " + err.Error())
+	all := !bURP && !bUMISR && !bAMISR && !bUAV // if no option at all <=> all options selected
+	h, err := collectHealth(server, all)
+	if err != nil {
+		clusterError(cluster, err)
 		return
 	}
-	all := !bURP && !bUMISR && !bAMISR && !bUAV // if no option at all <=> all options selected
+	fmt.Printf("%s: URP: %3d, UMISR: %3d, AMISR: %3d, UNAV: %3d\n", cluster, h.nURP, h.nUMISR, h.nAMISR, h.nUNAV)
+	addWatchMetric("urp", float64(h.nURP))
+	addWatchMetric("umisr", float64(h.nUMISR))
+	addWatchMetric("amisr", float64(h.nAMISR))
+	addWatchMetric("unav", float64(h.nUNAV))
+	if !short {
+		fmt.Println("\n URP:\n", h.resURP, "\n UMISR:\n", h.resUMISR, "\n AMISR:\n", h.resAMISR, "\n UNAV:\n", h.resUNAV)
+	}
+}
+
+// Run the URP, UMISR, AMISR and UNAV checks : all of them if all is true, else only the ones selected on the command line
+func collectHealth(server string, all bool) (HEALTH, error) {
+	var h HEALTH
+	if err := check_conn(server); err != nil {
+		return h, err
+	}
 	var errURP, errUMISR, errAMISR, errUNAV error
-	var resURP, resUMISR, resAMISR, resUNAV string
-	var wg sync.WaitGroup
+	var tasks TASKS
 	if all || bURP {
-		topics_runCmdForHealthCheckAsync(&wg, server, URP, &resURP, &errURP)
+		topics_runCmdForHealthCheckAsync(&tasks, server, URP, &h.resURP, &errURP)
 	}
 	if all || bUMISR {
-		topics_runCmdForHealthCheckAsync(&wg, server, UMISR, &resUMISR, &errUMISR)
+		topics_runCmdForHealthCheckAsync(&tasks, server, UMISR, &h.resUMISR, &errUMISR)
 	}
 	if all || bAMISR {
-		topics_runCmdForHealthCheckAsync(&wg, server, AMISR, &resAMISR, &errAMISR)
+		topics_runCmdForHealthCheckAsync(&tasks, server, AMISR, &h.resAMISR, &errAMISR)
 	}
 	if all || bUAV {
-		topics_runCmdForHealthCheckAsync(&wg, server, UNAV, &resUNAV, &errUNAV)
-	}
-	wg.Wait()
-	if logErr(errURP, errUMISR, errAMISR, errUNAV) {
-		return
+		topics_runCmdForHealthCheckAsync(&tasks, server, UNAV, &h.resUNAV, &errUNAV)
 	}
-	nURP, nUMISR, nAMISR, nUNAV := nbLines(resURP, resUMISR, resAMISR, resUNAV)
-	fmt.Printf("%s: URP: %3d, UMISR: %3d, AMISR: %3d, UNAV: %3d\n", cluster, nURP, nUMISR, nAMISR, nUNAV)
-	if !short {
-		fmt.Println("\n URP:\n", resURP, "\n UMISR:\n", resUMISR, "\n AMISR:\n", resAMISR, "\n UNAV:\n", resUNAV)
+	tasks.Wait()
+	for _, err := range []error{errURP, errUMISR, errAMISR, errUNAV} {
+		if err != nil {
+			return h, err
+		}
 	}
+	h.nURP, h.nUMISR, h.nAMISR, h.nUNAV = nbLines(h.resURP, h.resUMISR, h.resAMISR, h.resUNAV)
+	return h, nil
 }
 
-func topics_runCmdForHealthCheckAsync(wg *sync.WaitGroup, broker, option string, res *string, err *error) {
-	wg.Add(1)
-	go func(res *string, err *error) {
+func topics_runCmdForHealthCheckAsync(tasks *TASKS, broker, option string, res *string, err *error) {
+	tasks.Go(broker, func() {
 		*res, *err = topics_cmdForHealthCheck(broker, option)
-		wg.Done()
-	}(res, err)
+	})
 }
 
 func topics_cmdForHealthCheck(broker, option string) (string, error) {
-	log.Debug("Run command : kafka-topics.sh --bootstrap-server " + broker + " --describe " + option)
-	ecmd := exec.Command("kafka-topics.sh", "--bootstrap-server", broker, "--describe", option)
-	var out bytes.Buffer
-	ecmd.Stdout = &out
-	if err := ecmd.Run(); err != nil {
-		return "", err
-	}
-	return out.String(), nil
+	return runCommand("kafka-topics.sh", "--bootstrap-server", broker, "--describe", option)
 }
 
 func nbLines(res1, res2, res3, res4 string) (int, int, int, int) {
@@ -0,0 +1,159 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A broker as registered in the cluster metadata
+type BROKERINFO struct {
+	id         int
+	host, port string
+}
+
+// Result of the comparison between the inventory and the cluster metadata
+type BROKERSCHECK struct {
+	inventory, unexpected []string
+	registered            []BROKERINFO
+	missing, unreachable  []string
+	noLogDirs             []int    // brokers registered but absent from kafka-log-dirs.sh
+	idChanged             []string // brokers registered with another id than the broker_id of the inventory
+}
+
+// List the brokers registered in the cluster
+func brokers_cmdApiVersions(servers string) (string, error) {
+	if err := check_conn(servers); err != nil {
+		return "", errors.New("No connection to the VMs\n" + err.Error())
+	}
+	return runCommand("kafka-broker-api-versions.sh", "--bootstrap-server", servers)
+}
+
+// Extract the brokers from lines like : bktv2800.os.amadeus.net:9092 (id: 0 rack: null) -> (
+func parseApiVersions(out string) []BROKERINFO {
+	re := regexp.MustCompile(`^(\S+):(\d+)\s+\(id:\s*(\d+)\s+rack:.*\)\s+->`)
+	res := make([]BROKERINFO, 0)
+	for _, line := range strings.Split(out, "\n") {
+		as := re.FindStringSubmatch(strings.TrimSpace(line))
+		if len(as) != 4 {
+			continue
+		}
+		id, err := strconv.Atoi(as[3])
+		if logErr(err) {
+			continue
+		}
+		res = append(res, BROKERINFO{id: id, host: as[1], port: as[2]})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].id < res[j].id })
+	return res
+}
+
+// Short host name, used to compare the inventory and the metadata (e.g. bktv2800.os.amadeus.net => bktv2800)
+func shortHost(host string) string {
+	return strings.ToLower(strings.Split(host, ".")[0])
+}
+
+// Compare the brokers of the inventory (bootstrap servers) with the brokers registered in the cluster metadata and in the log dirs
+func checkBrokers(server SERVER) (BROKERSCHECK, error) {
+	var bc BROKERSCHECK
+	registered := make(map[string]bool)
+	for _, hp := range strings.Split(server.bootstrap, ",") {
+		h := strings.Split(hp, ":")
+		if len(h) != 2 {
+			continue
+		}
+		bc.inventory = append(bc.inventory, h[0])
+		if ok, _ := raw_connect(h[0], h[1]); !ok {
+			bc.unreachable = append(bc.unreachable, h[0])
+		}
+	}
+	out, err := brokers_cmdApiVersions(server.bootstrap)
+	if err != nil {
+		return bc, err
+	}
+	bc.registered = parseApiVersions(out)
+	for _, b := range bc.registered {
+		registered[shortHost(b.host)] = true
+	}
+	inventory := make(map[string]bool)
+	for _, h := range bc.inventory {
+		inventory[shortHost(h)] = true
+		if !registered[shortHost(h)] {
+			bc.missing = append(bc.missing, h)
+		}
+	}
+	for _, b := range bc.registered {
+		if !inventory[shortHost(b.host)] {
+			bc.unexpected = append(bc.unexpected, fmt.Sprintf("%s(%d)", b.host, b.id))
+		}
+		if id, exist := server.brokerids[shortHost(b.host)]; exist && id != b.id {
+			bc.idChanged = append(bc.idChanged, fmt.Sprintf("%s(%d instead of %d)", b.host, b.id, id))
+		}
+	}
+	temp, err := info_logdirs(server.bootstrap)
+	if err != nil {
+		return bc, err
+	}
+	ld, err := parseLogDirs(temp)
+	if err != nil {
+		return bc, err
+	}
+	logdirs := make(map[int]bool)
+	for _, b := range ld.Brokers {
+		logdirs[b.Broker] = true
+	}
+	for _, b := range bc.registered {
+		if !logdirs[b.id] {
+			bc.noLogDirs = append(bc.noLogDirs, b.id)
+		}
+	}
+	return bc, nil
+}
+
+// Parse the JSON line of the output of kafka-log-dirs.sh --describe, which follows the "Received log directory information" line
+func parseLogDirs(out string) (LOGDIRS, error) {
+	var ld LOGDIRS
+	lines := strings.Split(out, "\n")
+	if len(lines) < 3 {
+		return ld, errors.New("No log dirs in the output of kafka-log-dirs.sh : " + strings.TrimSpace(out))
+	}
+	err := json.Unmarshal([]byte(lines[2]), &ld)
+	return ld, err
+}
+
+func orDash(s []string) string {
+	if len(s) == 0 {
+		return "-"
+	}
+	return strings.Join(s, ",")
+}
+
+func (bc BROKERSCHECK) String() string {
+	ids := make([]int, len(bc.registered))
+	for i, b := range bc.registered {
+		ids[i] = b.id
+	}
+	noLogDirs := "-"
+	if len(bc.noLogDirs) > 0 {
+		noLogDirs = intJoin(bc.noLogDirs, ",")
+	}
+	return fmt.Sprintf("BROKERS: %d in inventory, %d registered [%s], missing: %s, unexpected: %s, id changed: %s, unreachable: %s, without log dirs: %s",
+		len(bc.inventory), len(bc.registered), intJoin(ids, ","), orDash(bc.missing), orDash(bc.unexpected), orDash(bc.idChanged), orDash(bc.unreachable), noLogDirs)
+}
+
+// Check the brokers of the given cluster and display the result
+func checkServerBrokers(server SERVER) {
+	bc, err := checkBrokers(server)
+	if err != nil {
+		clusterError(server.cluster, err)
+		if len(bc.unreachable) > 0 {
+			fmt.Printf("%s: BROKERS: unreachable: %s\n", server.cluster, orDash(bc.unreachable))
+		}
+		return
+	}
+	fmt.Printf("%s: %s\n", server.cluster, bc)
+}
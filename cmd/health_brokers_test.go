@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckBrokers(t *testing.T) {
+	server := SERVER{cluster: "cluster1", bootstrap: "bk1.example.net:9092,bk2.example.net:9092",
+		brokerids: map[string]int{"bk1": 1, "bk2": 2}}
+	replayFixtures(t, map[string]string{"conn bk1.example.net:9092": "", "conn bk2.example.net:9092": ""})
+	apiVersions := "bk1.example.net:9092 (id: 1 rack: null) -> (\n" +
+		"bk2.example.net:9092 (id: 4 rack: null) -> (\n" // bk2 came back with a new disk and another id
+	for _, tc := range []struct {
+		logDirs, want, err string
+	}{
+		{"Querying brokers for log directories information\nReceived log directory information from brokers 1,4\n" +
+			`{"version":1,"brokers":[{"broker":1,"logDirs":[]},{"broker":4,"logDirs":[]}]}` + "\n",
+			"id changed: bk2.example.net(4 instead of 2), unreachable: -, without log dirs: -", ""},
+		{"Querying brokers for log directories information\n", "", "No log dirs"},
+	} {
+		fakeRunner(t, map[string]string{
+			"kafka-broker-api-versions.sh --bootstrap-server " + server.bootstrap:      apiVersions,
+			"kafka-log-dirs.sh --bootstrap-server " + server.bootstrap + " --describe": tc.logDirs,
+		})
+		bc, err := checkBrokers(server)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("error = %v, want %s", err, tc.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasSuffix(bc.String(), tc.want) {
+			t.Errorf("%s, want it ending with %s", bc, tc.want)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// State of one zookeeper server, from the four letter words ruok, srvr and mntr
+type ZKSTATE struct {
+	server, mode         string
+	ok                   bool
+	followers, synced    int
+	outstanding, latency string
+	err                  error
+}
+
+// State of the KRaft metadata quorum, from kafka-metadata-quorum.sh
+type KRAFTSTATE struct {
+	leader, epoch, highWatermark string
+	voters, observers            string
+	replication                  []string // one line per voter/observer : NodeId LogEndOffset Lag ...
+}
+
+// Send a four letter word (e.g. ruok, srvr, mntr) to a zookeeper server and return the answer
+func fourLetterWord(server, word string) (string, error) {
+	res, _, err := recorded("4lw "+server+" "+word, func() (string, string, error) {
+		dialer := net.Dialer{Timeout: time.Duration(timeout) * time.Millisecond}
+		conn, err := dialer.DialContext(rootCtx, "tcp", server)
+		if err != nil {
+			return "", "", err
+		}
+		defer conn.Close()
+		end := time.Now().Add(time.Duration(httpTimeout) * time.Millisecond)
+		if d, ok := rootCtx.Deadline(); ok && d.Before(end) { // --deadline
+			end = d
+		}
+		conn.SetDeadline(end)
+		if _, err := conn.Write([]byte(word)); err != nil {
+			return "", "", err
+		}
+		res, err := io.ReadAll(conn)
+		if err != nil {
+			return "", "", err
+		}
+		if strings.Contains(string(res), "is not executed because it is not in the whitelist") {
+			return "", "", errors.New(word + " is not in the 4lw.commands.whitelist of " + server)
+		}
+		return string(res), "", nil
+	}, plainError)
+	return res, err
+}
+
+// Return the value of the given key for answers of the form "key: value" (srvr) or "key\tvalue" (mntr)
+func fourLetterValue(answer, key string) string {
+	re := regexp.MustCompile(`(?m)^` + regexp.QuoteMeta(key) + `(?::\s*|\t)(.*)$`)
+	if as := re.FindStringSubmatch(answer); len(as) == 2 {
+		return strings.TrimSpace(as[1])
+	}
+	return ""
+}
+
+func zkState(server string) ZKSTATE {
+	zs := ZKSTATE{server: server}
+	ruok, err := fourLetterWord(server, "ruok")
+	if err != nil {
+		zs.err = err
+		return zs
+	}
+	zs.ok = strings.TrimSpace(ruok) == "imok"
+	srvr, err := fourLetterWord(server, "srvr")
+	if err != nil {
+		zs.err = err
+		return zs
+	}
+	zs.mode = fourLetterValue(srvr, "Mode")
+	zs.latency = fourLetterValue(srvr, "Latency min/avg/max")
+	zs.outstanding = fourLetterValue(srvr, "Outstanding")
+	if zs.mode == "leader" {
+		mntr, err := fourLetterWord(server, "mntr")
+		if err != nil {
+			log.Warn(err)
+			return zs
+		}
+		zs.followers, _ = strconv.Atoi(fourLetterValue(mntr, "zk_followers"))
+		zs.synced, _ = strconv.Atoi(fourLetterValue(mntr, "zk_synced_followers"))
+	}
+	return zs
+}
+
+// Read a znode with zookeeper-shell.sh and return the first line of the output matching re (the data)
+func zk_cmdGet(zookeepers, znode string, re *regexp.Regexp) (string, error) {
+	out, err := runCommand("zookeeper-shell.sh", zookeepers, "get", znode)
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(out, "\n") {
+		if line = strings.TrimSpace(line); re.MatchString(line) {
+			return line, nil
+		}
+	}
+	return "", errors.New("No data found in znode " + znode)
+}
+
+// Return the active controller id and the controller epoch
+func zkController(zookeepers string) (string, string, error) {
+	data, err := zk_cmdGet(zookeepers, "/controller", regexp.MustCompile(`^\{.*"brokerid".*\}$`))
+	if err != nil {
+		return "", "", err
+	}
+	var controller struct {
+		Brokerid int `json:"brokerid"`
+	}
+	if err := json.Unmarshal([]byte(data), &controller); err != nil {
+		return "", "", errors.New("Bad /controller znode : " + data)
+	}
+	epoch, err := zk_cmdGet(zookeepers, "/controller_epoch", regexp.MustCompile(`^\d+$`))
+	if err != nil {
+		return "", "", err
+	}
+	return strconv.Itoa(controller.Brokerid), epoch, nil
+}
+
+func quorum_cmd(servers, option string) (string, error) {
+	return runCommand("kafka-metadata-quorum.sh", "--bootstrap-server", servers, "describe", option)
+}
+
+// Parse the "Key: value" lines of kafka-metadata-quorum.sh describe --status, e.g.
+// LeaderId:               1
+// CurrentVoters:          [1,2,3]  (or [{"id": 1, "directoryId": ..., "endpoints": [...]}, ...] since kafka 3.7)
+func parseQuorumStatus(out string) (KRAFTSTATE, error) {
+	var ks KRAFTSTATE
+	values := make(map[string]string)
+	for _, line := range strings.Split(out, "\n") {
+		kv := strings.SplitN(line, ":", 2)
+		if len(kv) == 2 && !strings.ContainsAny(kv[0], " \t") {
+			values[kv[0]] = strings.TrimSpace(kv[1])
+		}
+	}
+	if values["LeaderId"] == "" {
+		return ks, errors.New("No LeaderId in the output of kafka-metadata-quorum.sh : " + strings.TrimSpace(out))
+	}
+	ks.leader, ks.epoch, ks.highWatermark = values["LeaderId"], values["LeaderEpoch"], values["HighWatermark"]
+	ks.voters, ks.observers = quorumNodes(values["CurrentVoters"]), quorumNodes(values["CurrentObservers"])
+	return ks, nil
+}
+
+// The node ids of a list of voters or observers, e.g. [1,2,3]
+func quorumNodes(list string) string {
+	if !strings.Contains(list, "{") {
+		return list
+	}
+	ids := make([]string, 0)
+	for _, as := range regexp.MustCompile(`"id":\s*(\d+)`).FindAllStringSubmatch(list, -1) {
+		ids = append(ids, as[1])
+	}
+	return "[" + strings.Join(ids, ",") + "]"
+}
+
+func kraftState(servers string) (KRAFTSTATE, error) {
+	status, err := quorum_cmd(servers, "--status")
+	if err != nil {
+		return KRAFTSTATE{}, err
+	}
+	ks, err := parseQuorumStatus(status)
+	if err != nil {
+		return ks, err
+	}
+	replication, err := quorum_cmd(servers, "--replication")
+	if err != nil {
+		return ks, err
+	}
+	for _, line := range strings.Split(replication, "\n") {
+		if strings.TrimSpace(line) != "" {
+			ks.replication = append(ks.replication, line)
+		}
+	}
+	return ks, nil
+}
+
+// Check the controller and the zookeeper ensemble, or the KRaft quorum if the cluster has no zookeeper
+func checkServerQuorum(server SERVER) {
+	if strings.TrimSpace(server.zookeepers) == "" {
+		if err := check_conn(server.bootstrap); err != nil {
+			log.Error(server.bootstrap + " " + err.Error())
+			return
+		}
+		ks, err := kraftState(server.bootstrap)
+		if err != nil && !server.inventory {
+			fmt.Printf("%s: QUORUM: zookeeper unknown (no inventory, use --git-branch or --inv), kafka-metadata-quorum.sh failed : %s\n", server.cluster, err)
+			return
+		}
+		if err != nil {
+			log.Error(server.cluster + " : no zookeeper in the inventory and kafka-metadata-quorum.sh failed : " + err.Error())
+			return
+		}
+		fmt.Printf("%s: QUORUM: leader %s (epoch %s), voters %s, observers %s, high watermark %s\n",
+			server.cluster, ks.leader, ks.epoch, ks.voters, ks.observers, ks.highWatermark)
+		if !short {
+			for _, r := range ks.replication {
+				fmt.Println("  " + r)
+			}
+		}
+		return
+	}
+	zks := strings.Split(server.zookeepers, ",")
+	states := make([]ZKSTATE, len(zks))
+	nOk, leader := 0, ""
+	for i, zk := range zks {
+		states[i] = zkState(zk)
+		if states[i].ok {
+			nOk++
+		}
+		if states[i].mode == "leader" || states[i].mode == "standalone" {
+			leader = zk
+		}
+	}
+	controller, epoch, err := zkController(server.zookeepers)
+	if logErr(err) {
+		controller, epoch = "?", "?"
+	}
+	zkStatus := "NO LEADER"
+	for _, s := range states {
+		if s.mode == "leader" {
+			zkStatus = fmt.Sprintf("leader %s, followers %d/%d synced", shortHost(leader), s.synced, s.followers)
+		} else if s.mode == "standalone" {
+			zkStatus = "standalone " + shortHost(leader)
+		}
+	}
+	fmt.Printf("%s: CONTROLLER: broker %s (epoch %s), ZOOKEEPER: %s, imok %d/%d\n", server.cluster, controller, epoch, zkStatus, nOk, len(zks))
+	if !short {
+		for _, s := range states {
+			if s.err != nil {
+				fmt.Printf("  %s  %s\n", s.server, s.err)
+			} else {
+				fmt.Printf("  %s  %-10s ok=%t latency(min/avg/max)=%s outstanding=%s\n", s.server, s.mode, s.ok, s.latency, s.outstanding)
+			}
+		}
+	}
+}
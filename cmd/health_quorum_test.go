@@ -0,0 +1,64 @@
+package cmd
+
+import "testing"
+
+func TestParseQuorumStatus(t *testing.T) {
+	for _, tc := range []struct{ out, voters, observers string }{
+		{"ClusterId:              5L6g3nShT-eMCtK--X86sw\nLeaderId:               1\nLeaderEpoch:            15\nHighWatermark:          12345\n" +
+			"MaxFollowerLag:         0\nMaxFollowerLagTimeMs:   0\nCurrentVoters:          [1,2,3]\nCurrentObservers:       [4,5]\n", "[1,2,3]", "[4,5]"},
+		{"ClusterId:              5L6g3nShT-eMCtK--X86sw\nLeaderId:               1\nLeaderEpoch:            15\nHighWatermark:          12345\n" +
+			`CurrentVoters:          [{"id": 1, "directoryId": "qZ1kA2", "endpoints": ["CONTROLLER://ctl1:9093"]}, {"id": 2, "directoryId": "pY3bB4", "endpoints": ["CONTROLLER://ctl2:9093"]}]` + "\n" +
+			"CurrentObservers:       []\n", "[1,2]", "[]"},
+	} {
+		ks, err := parseQuorumStatus(tc.out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ks.leader != "1" || ks.epoch != "15" || ks.highWatermark != "12345" || ks.voters != tc.voters || ks.observers != tc.observers {
+			t.Errorf("state = %+v, want leader 1 epoch 15 high watermark 12345 voters %s observers %s", ks, tc.voters, tc.observers)
+		}
+	}
+	if _, err := parseQuorumStatus("Error while executing kafka-metadata-quorum.sh\n"); err == nil {
+		t.Error("no error without LeaderId")
+	}
+}
+
+func TestLoadInvFileZookeepers(t *testing.T) {
+	for _, tc := range []struct {
+		inv  string
+		want map[string][2]string // cluster => bootstrap, zookeepers
+	}{
+		{"[bkt28]\nbktv2800.os.amadeus.net\nbztv2800.os.amadeus.net\n\n[bkt29]\nbktv2900.os.amadeus.net\n\n[zk_servers]\nbztv2800.os.amadeus.net\n",
+			map[string][2]string{"bkt28": {"bktv2800.os.amadeus.net:9092", "bztv2800.os.amadeus.net:2181"}, "bkt29": {"bktv2900.os.amadeus.net:9092", ""}}},
+		{"[bkt28]\nbktv2800.os.amadeus.net\n\n[zk_servers]\nbztv2801.os.amadeus.net\nbztv2800.os.amadeus.net\n",
+			map[string][2]string{"bkt28": {"bktv2800.os.amadeus.net:9092", "bztv2800.os.amadeus.net:2181,bztv2801.os.amadeus.net:2181"}}},
+	} {
+		testInventory(t, tc.inv)
+		servers, err := LoadInvFile()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := make(map[string][2]string)
+		for _, s := range servers {
+			if !s.inventory {
+				t.Errorf("%s not marked as built from an inventory", s.cluster)
+			}
+			got[s.cluster] = [2]string{s.bootstrap, s.zookeepers}
+		}
+		if len(got) != len(tc.want) {
+			t.Errorf("servers = %v, want %v", got, tc.want)
+		}
+		for c, w := range tc.want {
+			if got[c] != w {
+				t.Errorf("%s = %v, want %v", c, got[c], w)
+			}
+		}
+	}
+}
+
+func TestFourLetterWordReplay(t *testing.T) {
+	replayFixtures(t, map[string]string{"4lw bztv2800.os.amadeus.net:2181 ruok": "imok"})
+	if res, err := fourLetterWord("bztv2800.os.amadeus.net:2181", "ruok"); res != "imok" || err != nil {
+		t.Errorf("ruok = %q, %v, want imok", res, err)
+	}
+}
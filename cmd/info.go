@@ -1,13 +1,12 @@
 package cmd
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
-	"os/exec"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -22,11 +21,20 @@ var infoCmd = &cobra.Command{
 	Use:   "info",
 	Short: "[ERDING] Display some stats of the given cluster(s)",
 	Long: `Used together with git, display some info of all clusters that are in the branch repository (e.g. ERDING_DEV)
+	One row (--short) or column per broker, sorted by broker id, with the totals per cluster, per branch and overall.
 	Note : use the --http-timeout option to increase the timeout.
 	e.g. go run kstat.go --git-branch ERDING_DEV --git-login jimbert --short info `,
 	Run: func(cmd *cobra.Command, args []string) {
 		servers, err := initServers()
 		logFatal(err)
+		if info_traffic {
+			displayTraffic(servers, collectTraffic(servers))
+			return
+		}
+		if info_host {
+			displayHosts(servers, collectHosts(servers))
+			return
+		}
 		nodeMetrics := initNodeMetrics()
 		kafkaMetrics := initKafkaMetrics()
 		fillInfo(servers, nodeMetrics, kafkaMetrics)
@@ -37,6 +45,10 @@ var infoCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(infoCmd)
 	// Cobra supports local flags which will only run when this command is called directly, e.g.:
+	infoCmd.Flags().BoolVarP(&info_traffic, "traffic", "", false, "Display the throughput, request rates and latencies, ISR changes and idle ratios of the brokers, and flag the hot brokers")
+	infoCmd.Flags().BoolVarP(&info_host, "host", "", false, "Display the cpu, load, memory, network, file systems, file descriptors and uptime of the broker hosts, and flag the hosts needing attention")
+	infoCmd.Flags().DurationVarP(&info_trafficInterval, "traffic-interval", "", 10*time.Second, "With --traffic or --host, interval between the two scrapes used to compute the rates")
+	infoCmd.Flags().Float64VarP(&info_hotRatio, "hot-ratio", "", 1.5, "With --traffic, flag the brokers whose throughput is above this ratio of the cluster average")
 }
 
 func initNodeMetrics() []string {
@@ -55,10 +67,34 @@ func initKafkaMetrics() []string {
 
 // Send a GET request to the broker on the given port at /metrics
 func sendRequest(broker, port string) ([]byte, error) {
-	client := &http.Client{Timeout: time.Duration(httpTimeout) * time.Millisecond}
+	return sendNthRequest(broker, port, 1)
+}
+
+// Same as sendRequest; the nth request of the same url is recorded apart, so that the rates computed from two requests can be replayed
+func sendNthRequest(broker, port string, n int) ([]byte, error) {
 	furl := "http://" + broker + ":" + port + "/metrics"
+	key := "http " + furl
+	if n > 1 {
+		key += fmt.Sprintf(" #%d", n)
+	}
+	body, _, err := recorded(key, func() (string, string, error) {
+		body, err := httpGet(furl)
+		return string(body), "", err
+	}, plainError)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(body), nil
+}
+
+func httpGet(furl string) ([]byte, error) {
+	client := &http.Client{Timeout: time.Duration(httpTimeout) * time.Millisecond}
 	log.Debug("Send request to " + furl)
-	r, err := client.Get(furl)
+	req, err := http.NewRequestWithContext(rootCtx, http.MethodGet, furl, nil)
+	if err != nil {
+		return nil, err
+	}
+	r, err := client.Do(req)
 	if r != nil {
 		defer r.Body.Close()
 	}
@@ -107,83 +143,125 @@ func infoGetMetrics(body []byte, metrics []string) map[string]METRIC {
 	return res
 }
 
+// Fill the metrics of the brokers of the server, identified by their host and broker id, sorted by broker id
 func fillBrokerMetrics(server *SERVER, nodeMetrics, kafkaMetrics []string) {
-	var wg sync.WaitGroup
+	var tasks TASKS
+	var results COLLECTOR[BROKERMETRICS]
+	var ids map[string]int
+	tasks.Go(server.bootstrap, func() {
+		ids = brokerIds(*server)
+	})
 	brokers := strings.Split(server.bootstrap, ",")
 	for _, bp := range brokers {
-		b := strings.Split(bp, ":")
-		wg.Add(1)
-		go func(broker string) {
-			m := make(map[string]METRIC, 0)
-			body, err := sendRequest(broker, "50700")
-			if !logErr(err) {
-				m = infoGetMetrics(body, nodeMetrics)
-			}
-			body, err = sendRequest(broker, "50721")
-			if !logErr(err) {
-				m2 := infoGetMetrics(body, kafkaMetrics)
-				for k, v := range m2 {
-					m[k] = v
-				}
-			}
-			server.brokermetrics = append(server.brokermetrics, BROKERMETRICS{metrics: m})
-			wg.Done()
-		}(b[0])
-		wg.Wait()
+		broker := strings.Split(bp, ":")[0]
+		tasks.Go(server.bootstrap, func() {
+			results.add(RESULT[BROKERMETRICS]{cluster: server.cluster, broker: broker, value: brokerMetrics(broker, nodeMetrics, kafkaMetrics)})
+		})
+	}
+	tasks.Wait()
+	bms := results.values()
+	for i := range bms {
+		if id, exist := ids[shortHost(bms[i].host)]; exist {
+			bms[i].id = id
+		}
+	}
+	sortBrokerMetrics(bms)
+	server.brokermetrics = bms
+}
+
+// Broker ids per short host name, from the cluster metadata, else from the inventory
+func brokerIds(server SERVER) map[string]int {
+	ids := make(map[string]int)
+	for h, id := range server.brokerids {
+		ids[h] = id
+	}
+	out, err := brokers_cmdApiVersions(server.bootstrap)
+	if !logErr(err) {
+		for _, b := range parseApiVersions(out) {
+			ids[shortHost(b.host)] = b.id
+		}
+	}
+	return ids
+}
+
+// Sort by broker id, the brokers not found in the metadata at the end
+func sortBrokerMetrics(bms []BROKERMETRICS) {
+	sort.SliceStable(bms, func(i, j int) bool { return brokerLess(bms[i], bms[j]) })
+}
+
+func brokerLess(a, b BROKERMETRICS) bool {
+	if (a.id < 0) != (b.id < 0) {
+		return b.id < 0
+	}
+	return a.id < b.id
+}
+
+// Broker id and host, e.g. #1 bkuv1001.os.amadeus.net
+func (bm BROKERMETRICS) label() string {
+	if bm.id < 0 {
+		return "#? " + bm.host
+	}
+	return fmt.Sprintf("#%d %s", bm.id, bm.host)
+}
+
+// Get the node exporter and JMX metrics of one broker
+func brokerMetrics(broker string, nodeMetrics, kafkaMetrics []string) BROKERMETRICS {
+	m := make(map[string]METRIC, 0)
+	body, err := sendRequest(broker, "50700")
+	if !logErr(err) {
+		m = infoGetMetrics(body, nodeMetrics)
+	}
+	body, err = sendRequest(broker, "50721")
+	if !logErr(err) {
+		m2 := infoGetMetrics(body, kafkaMetrics)
+		for k, v := range m2 {
+			m[k] = v
+		}
 	}
+	return BROKERMETRICS{host: broker, id: -1, metrics: m}
 }
 
 func fillInfo(servers []SERVER, nodeMetrics, kafkaMetrics []string) {
 	var wg sync.WaitGroup
+	var tasks TASKS
 	for i := range servers {
+		s := &servers[i]
 		wg.Add(1)
-		go func(s *SERVER) {
+		go func() { // fillBrokerMetrics schedules its own tasks
 			fillBrokerMetrics(s, nodeMetrics, kafkaMetrics)
 			wg.Done()
-		}(&servers[i])
+		}()
 
-		wg.Add(1)
-		go func(s *SERVER) {
+		tasks.Go(s.bootstrap, func() {
 			tpcs, err := topics_cmdList(s.bootstrap)
 			if err != nil {
-				log.Error(s.cluster, err)
+				clusterError(s.cluster, err)
 			} else {
 				log.Debug(fmt.Sprintf("%s: topics = %s", s.cluster, tpcs))
 				s.topics = tpcs
 			}
-			wg.Done()
-		}(&servers[i])
+		})
 
-		wg.Add(1)
-		go func(s *SERVER) {
+		tasks.Go(s.bootstrap, func() {
 			temp, err := info_logdirs(s.bootstrap)
 			if logErr(err) {
-				wg.Done()
 				return
 			}
 			logdirs := strings.Split(temp, "\n")[2]
 			var ld LOGDIRS
 			err = json.Unmarshal([]byte(logdirs), &ld)
 			if logErr(err) {
-				wg.Done()
 				return
 			}
 			s.logdirs = ld
-			wg.Done()
-		}(&servers[i])
+		})
 	}
+	tasks.Wait()
 	wg.Wait()
 }
 
 func info_logdirs(broker string) (string, error) {
-	log.Debug("Run command : kafka-log-dirs.sh --bootstrap-server " + broker + " --describe")
-	ecmd := exec.Command("kafka-log-dirs.sh", "--bootstrap-server", broker, "--describe")
-	var out bytes.Buffer
-	ecmd.Stdout = &out
-	if err := ecmd.Run(); err != nil {
-		return "", err
-	}
-	return out.String(), nil
+	return runCommand("kafka-log-dirs.sh", "--bootstrap-server", broker, "--describe")
 }
 
 func computeLen(m []string) int {
@@ -255,40 +333,105 @@ func sum(ar []int) int {
 	return s
 }
 
+// Number of partitions per broker id
+func partitionsPerBroker(ld LOGDIRS) map[int]int {
+	res := make(map[int]int)
+	for _, b := range ld.Brokers {
+		if len(b.LogDirs) > 0 {
+			res[b.Broker] = len(b.LogDirs[0].Partitions)
+		}
+	}
+	return res
+}
+
+// Totals of a cluster, a branch or all servers
+type INFOTOTAL struct {
+	clusters, brokers, topics, partitions int
+	sizeG, availG                         float64
+}
+
+func (t *INFOTOTAL) add(o INFOTOTAL) {
+	t.clusters += o.clusters
+	t.brokers += o.brokers
+	t.topics += o.topics
+	t.partitions += o.partitions
+	t.sizeG += o.sizeG
+	t.availG += o.availG
+}
+
+func (t INFOTOTAL) String() string {
+	used := 0.
+	if t.sizeG > 0 {
+		used = 100 - t.availG/t.sizeG*100
+	}
+	return fmt.Sprintf("%d cluster(s), %d brokers, %d topics, %d partitions, disk total : %.0fG, used : %.2f%%", t.clusters, t.brokers, t.topics, t.partitions, t.sizeG, used)
+}
+
 func displayMetrics(servers []SERVER, nodeMetrics, kafkaMetrics []string) {
-	ntopics, ngiga, nparts := 0, 0., 0
+	var total INFOTOTAL
+	branches := make(map[string]*INFOTOTAL)
+	branchNames := make([]string, 0)
 	for _, s := range servers {
 		nt := numberOfTopics(s.topics)
-		partitions := computeNPartitions(s.logdirs)
-		nbPartitions := sum(partitions)
-		ntopics += nt
-		nparts += nbPartitions
+		parts := partitionsPerBroker(s.logdirs)
+		nbPartitions := sum(computeNPartitions(s.logdirs))
+		addWatchMetric("topics", float64(nt))
+		addWatchMetric("partitions", float64(nbPartitions))
+		ct := INFOTOTAL{clusters: 1, brokers: len(s.brokermetrics), topics: nt, partitions: nbPartitions}
+		for _, bm := range s.brokermetrics {
+			if g := toGiga(bm.metrics["node_filesystem_size_bytes"].v); g > 0 {
+				ct.sizeG += g
+				ct.availG += toGiga(bm.metrics["node_filesystem_avail_bytes"].v)
+			}
+		}
+		fmt.Printf("%s : %3d topics %4d partitions\n", s.cluster, nt, nbPartitions)
+		maxH := 0
+		for _, bm := range s.brokermetrics {
+			maxH = max(maxH, len(bm.label()))
+		}
 		if short {
-			fmt.Printf("%s : %3d %4d[%16s]  ", s.cluster, nt, nbPartitions, intJoin(partitions, ","))
+			fmt.Printf("  %-*s  %9s  %6s  %8s  %10s\n", maxH, "BROKER", "KAFKADATA", "SIZE", "VERSION", "PARTITIONS")
 			for _, bm := range s.brokermetrics {
-				kdata := computeKafkadata(bm.metrics)
-				ng := toGiga(bm.metrics["node_filesystem_size_bytes"].v)
-				ngiga += ng
-				fmt.Printf("%5.2f%%[%4.0fG] %5s  ", kdata, ng, bm.metrics["kafka_app_info"].v)
+				fmt.Printf("  %-*s  %8.2f%%  %5.0fG  %8s  %10d\n", maxH, bm.label(), computeKafkadata(bm.metrics), toGiga(bm.metrics["node_filesystem_size_bytes"].v),
+					bm.metrics["kafka_app_info"].v, parts[bm.id])
 			}
-			fmt.Printf("\n")
 		} else {
-			fmt.Printf("%s : %3d %4d[%16s]\n", s.cluster, nt, nbPartitions, intJoin(partitions, ","))
 			all := append(nodeMetrics, kafkaMetrics...)
-			maxL := computeLen(all)
+			maxL := computeLen(append(all, "partitions"))
+			width := max(maxH, 20)
+			fmt.Printf("  %-*s :", maxL, "broker")
+			for _, bm := range s.brokermetrics {
+				fmt.Printf(" %-*s", width, bm.label())
+			}
+			fmt.Println()
 			for _, m := range all {
-				fmt.Printf("%-*s : ", maxL, m)
+				fmt.Printf("  %-*s :", maxL, m)
 				for _, bm := range s.brokermetrics {
-					fmt.Printf(" %-20s ", bm.metrics[m].v)
+					fmt.Printf(" %-*s", width, bm.metrics[m].v)
 				}
-				fmt.Println(" ")
+				fmt.Println()
 			}
+			fmt.Printf("  %-*s :", maxL, "partitions")
 			for _, bm := range s.brokermetrics {
-				ngiga += toGiga(bm.metrics["node_filesystem_size_bytes"].v)
+				fmt.Printf(" %-*d", width, parts[bm.id])
+			}
+			fmt.Println()
+		}
+		fmt.Printf("  total : %s\n", ct)
+		total.add(ct)
+		if s.branch != "" {
+			if branches[s.branch] == nil {
+				branches[s.branch] = &INFOTOTAL{}
+				branchNames = append(branchNames, s.branch)
 			}
+			branches[s.branch].add(ct)
 		}
 	}
 	if len(servers) > 1 {
-		fmt.Printf("Nb servers : %d, Nb of topics : %d [%d], disk total : %.0fG\n", len(servers), ntopics, nparts, ngiga)
+		sort.Strings(branchNames)
+		for _, b := range branchNames {
+			fmt.Printf("Branch %s : %s\n", b, branches[b])
+		}
+		fmt.Printf("Total : %s\n", total)
 	}
 }
@@ -0,0 +1,196 @@
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+var info_host bool
+
+// Thresholds above which a host needs attention
+const (
+	hostMaxCpu   = 0.8  // ratio of the cpu time not idle
+	hostMaxLoad  = 1.0  // 5 minutes load average per cpu
+	hostMaxMem   = 0.9  // ratio of the memory not available
+	hostMaxMount = 0.85 // ratio of a file system used
+	hostMaxFds   = 0.8  // ratio of the file descriptors allocated
+)
+
+// File systems which are not disks
+var pseudoFs = []string{"tmpfs", "devtmpfs", "overlay", "squashfs", "rootfs", "nsfs", "autofs", "proc", "sysfs"}
+
+type MOUNT struct {
+	path       string
+	size, used float64 // bytes, ratio
+}
+
+// Resources of the host of a broker, from the node exporter; NaN when not exported
+type HOSTVIEW struct {
+	broker                   BROKERMETRICS // host and id
+	cpus                     int
+	cpu                      float64 // ratio of the cpu time not idle
+	load                     [3]float64
+	memTotal, memUsed, cache float64 // bytes, ratio, bytes
+	netIn, netOut, netErrs   float64 // per second, without the loopback
+	mounts                   []MOUNT
+	fds                      float64 // ratio of the file descriptors allocated
+	uptime                   float64 // seconds
+	flags                    []string
+	err                      error
+}
+
+// Host resources of the brokers of each server, sorted by broker id
+func collectHosts(servers []SERVER) [][]HOSTVIEW {
+	sc := scrapeTwice(servers, "50700")
+	res := make([][]HOSTVIEW, len(servers))
+	for i, s := range servers {
+		hvs := make([]HOSTVIEW, 0)
+		for _, bm := range sc.brokers(i, s) {
+			first, second, seconds, err := sc.of(s.cluster, bm.host)
+			hv := HOSTVIEW{err: err}
+			if err == nil {
+				hv = hostView(first, second, seconds)
+				hv.flags = hostFlags(hv)
+			}
+			hv.broker = bm
+			hvs = append(hvs, hv)
+		}
+		res[i] = hvs
+	}
+	return res
+}
+
+func hostView(first, second SCRAPE, seconds float64) HOSTVIEW {
+	var hv HOSTVIEW
+	idle := map[string]string{"mode": "idle"}
+	cpus := make(map[string]bool)
+	for _, s := range second.samples {
+		if s.name == "node_cpu_seconds_total" && s.labels["mode"] == "idle" {
+			cpus[s.labels["cpu"]] = true
+		}
+	}
+	hv.cpus = len(cpus)
+	hv.cpu = math.NaN()
+	if all := sampleValue(second.samples, "node_cpu_seconds_total", nil) - sampleValue(first.samples, "node_cpu_seconds_total", nil); all > 0 {
+		hv.cpu = 1 - (sampleValue(second.samples, "node_cpu_seconds_total", idle)-sampleValue(first.samples, "node_cpu_seconds_total", idle))/all
+	}
+	for i, m := range []string{"node_load1", "node_load5", "node_load15"} {
+		hv.load[i] = sampleValue(second.samples, m, nil)
+	}
+	hv.memTotal = sampleValue(second.samples, "node_memory_MemTotal_bytes", nil)
+	hv.memUsed = 1 - sampleValue(second.samples, "node_memory_MemAvailable_bytes", nil)/hv.memTotal
+	hv.cache = sampleValue(second.samples, "node_memory_Cached_bytes", nil) + sampleValue(second.samples, "node_memory_Buffers_bytes", nil)
+	notLo := func(s SAMPLE) bool { return s.labels["device"] != "lo" }
+	netRate := func(name string) float64 {
+		return rate(sampleSum(first.samples, name, notLo), sampleSum(second.samples, name, notLo), seconds)
+	}
+	hv.netIn, hv.netOut = netRate("node_network_receive_bytes_total"), netRate("node_network_transmit_bytes_total")
+	hv.netErrs = netRate("node_network_receive_errs_total") + netRate("node_network_transmit_errs_total")
+	hv.mounts = mounts(second.samples)
+	hv.fds = sampleValue(second.samples, "node_filefd_allocated", nil) / sampleValue(second.samples, "node_filefd_maximum", nil)
+	hv.uptime = sampleValue(second.samples, "node_time_seconds", nil) - sampleValue(second.samples, "node_boot_time_seconds", nil)
+	return hv
+}
+
+// The disk file systems, sorted by mount point
+func mounts(samples []SAMPLE) []MOUNT {
+	res := make([]MOUNT, 0)
+	seen := make(map[string]bool)
+	for _, s := range samples {
+		mp := s.labels["mountpoint"]
+		if s.name != "node_filesystem_size_bytes" || s.value == 0 || seen[mp] || inArray(pseudoFs, s.labels["fstype"]) {
+			continue
+		}
+		seen[mp] = true
+		avail := sampleValue(samples, "node_filesystem_avail_bytes", map[string]string{"mountpoint": mp, "device": s.labels["device"]})
+		res = append(res, MOUNT{path: mp, size: s.value, used: 1 - avail/s.value})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].path < res[j].path })
+	return res
+}
+
+// The reasons why the host needs attention
+func hostFlags(hv HOSTVIEW) []string {
+	flags := make([]string, 0)
+	if hv.cpu > hostMaxCpu {
+		flags = append(flags, fmt.Sprintf("cpu %.0f%%", hv.cpu*100))
+	}
+	if hv.cpus > 0 && hv.load[1]/float64(hv.cpus) > hostMaxLoad {
+		flags = append(flags, fmt.Sprintf("load %.1f per cpu", hv.load[1]/float64(hv.cpus)))
+	}
+	if hv.memUsed > hostMaxMem {
+		flags = append(flags, fmt.Sprintf("memory %.0f%%", hv.memUsed*100))
+	}
+	if hv.netErrs > 0 {
+		flags = append(flags, fmt.Sprintf("network errors %.2f/s", hv.netErrs))
+	}
+	for _, m := range hv.mounts {
+		if m.used > hostMaxMount {
+			flags = append(flags, fmt.Sprintf("%s %.0f%%", m.path, m.used*100))
+		}
+	}
+	if hv.fds > hostMaxFds {
+		flags = append(flags, fmt.Sprintf("file descriptors %.0f%%", hv.fds*100))
+	}
+	return flags
+}
+
+// Display a ratio as a percentage, "-" if unknown
+func percent(v float64) string {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return "-"
+	}
+	return fmt.Sprintf("%.0f%%", v*100)
+}
+
+func human(v float64) string {
+	if math.IsNaN(v) {
+		return "-"
+	}
+	return humanBytes(v)
+}
+
+// e.g. 12d03h
+func uptime(seconds float64) string {
+	if math.IsNaN(seconds) {
+		return "-"
+	}
+	d := time.Duration(seconds) * time.Second
+	return fmt.Sprintf("%dd%02dh", int(d.Hours())/24, int(d.Hours())%24)
+}
+
+func displayHosts(servers []SERVER, hosts [][]HOSTVIEW) {
+	for i, s := range servers {
+		fmt.Printf("%s :\n", s.cluster)
+		maxH := len("BROKER")
+		for _, hv := range hosts[i] {
+			maxH = max(maxH, len(hv.broker.label()))
+		}
+		fmt.Printf("  %-*s  %4s  %4s  %-16s  %4s  %7s  %7s  %7s  %7s  %9s  %4s  %7s\n", maxH, "BROKER", "CPU", "CPUS", "LOAD 1/5/15",
+			"MEM", "MEMORY", "CACHE", "NET IN", "NET OUT", "NET ERR/s", "FDS", "UPTIME")
+		attention := 0
+		for _, hv := range hosts[i] {
+			fmt.Printf("  %-*s", maxH, hv.broker.label())
+			if logErr(hv.err) {
+				fmt.Println("  no metrics")
+				continue
+			}
+			load := fmt.Sprintf("%.2f %.2f %.2f", hv.load[0], hv.load[1], hv.load[2])
+			fmt.Printf("  %4s  %4d  %-16s  %4s  %7s  %7s  %7s  %7s  %9.2f  %4s  %7s\n", percent(hv.cpu), hv.cpus, load, percent(hv.memUsed),
+				human(hv.memTotal), human(hv.cache), human(hv.netIn), human(hv.netOut), hv.netErrs, percent(hv.fds), uptime(hv.uptime))
+			ms := make([]string, len(hv.mounts))
+			for j, m := range hv.mounts {
+				ms[j] = fmt.Sprintf("%s %s of %s", m.path, percent(m.used), humanBytes(m.size))
+			}
+			fmt.Printf("      mounts : %s\n", strings.Join(ms, ", "))
+			if len(hv.flags) > 0 {
+				fmt.Printf("      ATTENTION : %s\n", strings.Join(hv.flags, ", "))
+				attention++
+			}
+		}
+		addWatchMetric("attention", float64(attention))
+	}
+}
@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestFillBrokerMetricsConcurrently(t *testing.T) {
+	testScheduler(t, 4, 2)
+	servers := make([]SERVER, 3)
+	outputs := make(map[string]string)
+	recordings := make(map[string]string)
+	for c := range servers {
+		hosts := make([]string, 0)
+		apiVersions := ""
+		for b := 0; b < 3; b++ {
+			host := fmt.Sprintf("bk%d%d.example.net", c, b)
+			hosts = append(hosts, host+":9092")
+			apiVersions += fmt.Sprintf("%s:9092 (id: %d rack: null) -> (\n", host, 3-b) // the ids are not in the order of the bootstrap
+			recordings["http http://"+host+":50700/metrics"] = fmt.Sprintf("node_filesystem_size_bytes{mountpoint=\"/opt/kafkadata\"} %d\n", 1000*(b+1))
+			recordings["http http://"+host+":50721/metrics"] = "kafka_app_info{version=\"3.6.1\",} 1.0\n"
+		}
+		servers[c] = SERVER{cluster: fmt.Sprintf("cluster%d", c), bootstrap: fmt.Sprintf("%s,%s,%s", hosts[0], hosts[1], hosts[2])}
+		recordings["conn "+hosts[0]] = ""
+		outputs["kafka-broker-api-versions.sh --bootstrap-server "+servers[c].bootstrap] = apiVersions
+	}
+	fakeRunner(t, outputs)
+	replayFixtures(t, recordings)
+
+	var wg sync.WaitGroup
+	for i := range servers {
+		wg.Add(1)
+		go func(s *SERVER) {
+			fillBrokerMetrics(s, []string{"node_filesystem_size_bytes"}, []string{"kafka_app_info"})
+			wg.Done()
+		}(&servers[i])
+	}
+	wg.Wait()
+
+	for c, s := range servers {
+		if len(s.brokermetrics) != 3 {
+			t.Fatalf("%s : %d brokers, want 3", s.cluster, len(s.brokermetrics))
+		}
+		for i, bm := range s.brokermetrics {
+			if bm.id != i+1 {
+				t.Errorf("%s : broker %d has id %d, want %d", s.cluster, i, bm.id, i+1)
+			}
+			if want := fmt.Sprintf("bk%d%d.example.net", c, 3-bm.id); bm.host != want {
+				t.Errorf("%s : broker #%d is %s, want %s", s.cluster, bm.id, bm.host, want)
+			}
+			if want := fmt.Sprint(1000 * (4 - bm.id)); bm.metrics["node_filesystem_size_bytes"].v != want {
+				t.Errorf("%s : size of #%d = %q, want %s", s.cluster, bm.id, bm.metrics["node_filesystem_size_bytes"].v, want)
+			}
+			if bm.metrics["kafka_app_info"].v != "3.6.1" {
+				t.Errorf("%s : version of #%d = %q, want 3.6.1", s.cluster, bm.id, bm.metrics["kafka_app_info"].v)
+			}
+		}
+	}
+}
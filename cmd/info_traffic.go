@@ -0,0 +1,277 @@
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+var info_traffic bool
+var info_trafficInterval time.Duration
+var info_hotRatio float64
+
+// Below this ratio, the request handlers or the network processors of a broker are flagged as busy
+const trafficMinIdle = 0.3
+
+// A broker metric of the JMX exporter (names given by the kafka rules of the jmx_exporter examples)
+type TRAFFICMETRIC struct {
+	name   string // column name
+	metric string // prometheus name
+	labels map[string]string
+	rate   bool    // counter : per second between the two scrapes
+	scale  float64 // applied to the value (e.g. idle nanoseconds per second to ratio)
+	unit   string  // "bytes", "ratio" or ""
+	hot    bool    // compared to the cluster average to find the hot brokers
+}
+
+var trafficMetrics = []TRAFFICMETRIC{
+	{"bytesin/s", "kafka_server_brokertopicmetrics_bytesin_total", nil, true, 1, "bytes", true},
+	{"bytesout/s", "kafka_server_brokertopicmetrics_bytesout_total", nil, true, 1, "bytes", true},
+	{"msgin/s", "kafka_server_brokertopicmetrics_messagesin_total", nil, true, 1, "", true},
+	{"produce/s", "kafka_network_requestmetrics_requests_total", map[string]string{"request": "Produce"}, true, 1, "", true},
+	{"fetch/s", "kafka_network_requestmetrics_requests_total", map[string]string{"request": "FetchConsumer"}, true, 1, "", true},
+	{"produce p99 ms", "kafka_network_requestmetrics_totaltimems", map[string]string{"request": "Produce", "quantile": "0.99"}, false, 1, "", false},
+	{"fetch p99 ms", "kafka_network_requestmetrics_totaltimems", map[string]string{"request": "FetchConsumer", "quantile": "0.99"}, false, 1, "", false},
+	{"isr shrinks/s", "kafka_server_replicamanager_isrshrinks_total", nil, true, 1, "", false},
+	{"isr expands/s", "kafka_server_replicamanager_isrexpands_total", nil, true, 1, "", false},
+	{"handler idle", "kafka_server_kafkarequesthandlerpool_requesthandleravgidlepercent_total", nil, true, 1e-9, "ratio", false},
+	{"network idle", "kafka_network_socketserver_networkprocessoravgidlepercent", nil, false, 1, "ratio", false},
+}
+
+// The traffic metrics of one broker, NaN when not exported
+type BROKERTRAFFIC struct {
+	broker BROKERMETRICS // host and id
+	values map[string]float64
+	flags  []string
+	err    error
+}
+
+// One scrape of the JMX exporter of a broker
+type SCRAPE struct {
+	samples []SAMPLE
+	at      time.Time
+}
+
+// Scrape the exporter on the given port of all the brokers; n identifies the scrape in the recordings
+func scrapeMetrics(servers []SERVER, port string, n int) map[string]RESULT[SCRAPE] {
+	var tasks TASKS
+	var results COLLECTOR[SCRAPE]
+	for _, s := range servers {
+		cluster := s.cluster
+		for _, bp := range strings.Split(s.bootstrap, ",") {
+			broker := strings.Split(bp, ":")[0]
+			tasks.Go(s.bootstrap, func() {
+				body, err := sendNthRequest(broker, port, n)
+				r := RESULT[SCRAPE]{cluster: cluster, broker: broker, err: err}
+				if err == nil {
+					r.value = SCRAPE{samples: parsePrometheus(string(body)), at: time.Now()}
+				}
+				results.add(r)
+			})
+		}
+	}
+	tasks.Wait()
+	res := make(map[string]RESULT[SCRAPE])
+	for _, r := range results.merge() {
+		res[r.cluster+" "+r.broker] = r
+	}
+	return res
+}
+
+// Two scrapes of all the brokers separated by --traffic-interval, to compute rates, and the broker ids per server
+type SCRAPES struct {
+	ids           []map[string]int
+	first, second map[string]RESULT[SCRAPE]
+}
+
+func scrapeTwice(servers []SERVER, port string) SCRAPES {
+	var tasks TASKS
+	sc := SCRAPES{ids: make([]map[string]int, len(servers))}
+	for i := range servers {
+		i := i
+		tasks.Go(servers[i].bootstrap, func() {
+			sc.ids[i] = brokerIds(servers[i])
+		})
+	}
+	sc.first = scrapeMetrics(servers, port, 1)
+	if replayDir == "" {
+		select {
+		case <-rootCtx.Done():
+		case <-time.After(info_trafficInterval):
+		}
+	}
+	sc.second = scrapeMetrics(servers, port, 2)
+	tasks.Wait()
+	return sc
+}
+
+// The brokers of the ith server, sorted by broker id
+func (sc SCRAPES) brokers(i int, s SERVER) []BROKERMETRICS {
+	bms := make([]BROKERMETRICS, 0)
+	for _, bp := range strings.Split(s.bootstrap, ",") {
+		bm := BROKERMETRICS{host: strings.Split(bp, ":")[0], id: -1}
+		if id, exist := sc.ids[i][shortHost(bm.host)]; exist {
+			bm.id = id
+		}
+		bms = append(bms, bm)
+	}
+	sortBrokerMetrics(bms)
+	return bms
+}
+
+// The two scrapes of the broker, the first error if any, and the seconds between them
+func (sc SCRAPES) of(cluster, broker string) (SCRAPE, SCRAPE, float64, error) {
+	first, second := sc.first[cluster+" "+broker], sc.second[cluster+" "+broker]
+	if first.err != nil {
+		return first.value, second.value, 0, first.err
+	}
+	if second.err != nil {
+		return first.value, second.value, 0, second.err
+	}
+	seconds := second.value.at.Sub(first.value.at).Seconds()
+	if replayDir != "" || seconds <= 0 {
+		seconds = info_trafficInterval.Seconds()
+	}
+	return first.value, second.value, seconds, nil
+}
+
+// Traffic of the brokers of each server, sorted by broker id
+func collectTraffic(servers []SERVER) [][]BROKERTRAFFIC {
+	sc := scrapeTwice(servers, "50721")
+	res := make([][]BROKERTRAFFIC, len(servers))
+	for i, s := range servers {
+		bts := make([]BROKERTRAFFIC, 0)
+		for _, bm := range sc.brokers(i, s) {
+			bt := BROKERTRAFFIC{broker: bm, values: make(map[string]float64)}
+			first, second, seconds, err := sc.of(s.cluster, bm.host)
+			if err != nil {
+				bt.err = err
+			} else {
+				bt.values = brokerTraffic(first, second, seconds)
+			}
+			bts = append(bts, bt)
+		}
+		flagHotBrokers(bts)
+		res[i] = bts
+	}
+	return res
+}
+
+// Compute the values of the metrics, the rates being computed between the two scrapes
+func brokerTraffic(first, second SCRAPE, seconds float64) map[string]float64 {
+	values := make(map[string]float64)
+	for _, m := range trafficMetrics {
+		v := sampleValue(second.samples, m.metric, m.labels)
+		if m.rate {
+			v = rate(sampleValue(first.samples, m.metric, m.labels), v, seconds)
+		}
+		values[m.name] = v * m.scale
+	}
+	return values
+}
+
+// Per second increase of a counter, NaN if it was reset by a restart
+func rate(first, second, seconds float64) float64 {
+	if second < first {
+		return math.NaN()
+	}
+	return (second - first) / seconds
+}
+
+// Flag the brokers whose throughput is above --hot-ratio of the cluster average, and the busy or shrinking ones
+func flagHotBrokers(bts []BROKERTRAFFIC) {
+	for _, m := range trafficMetrics {
+		if !m.hot {
+			continue
+		}
+		total, n := 0., 0
+		for _, bt := range bts {
+			if v, exist := bt.values[m.name]; exist && !math.IsNaN(v) {
+				total += v
+				n++
+			}
+		}
+		if n < 2 || total == 0 {
+			continue
+		}
+		avg := total / float64(n)
+		for i, bt := range bts {
+			if v := bt.values[m.name]; v > info_hotRatio*avg {
+				bts[i].flags = append(bts[i].flags, fmt.Sprintf("%s x%.1f", m.name, v/avg))
+			}
+		}
+	}
+	for i, bt := range bts {
+		for _, name := range []string{"handler idle", "network idle"} {
+			if v, exist := bt.values[name]; exist && v < trafficMinIdle {
+				bts[i].flags = append(bts[i].flags, fmt.Sprintf("%s %.0f%%", name, v*100))
+			}
+		}
+		if bt.values["isr shrinks/s"] > 0 {
+			bts[i].flags = append(bts[i].flags, "isr shrinks")
+		}
+	}
+}
+
+// Display a value of the metric, "-" if not exported
+func formatTraffic(m TRAFFICMETRIC, v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "-"
+	case m.unit == "bytes":
+		return humanBytes(v)
+	case m.unit == "ratio":
+		return fmt.Sprintf("%.0f%%", v*100)
+	case v >= 100:
+		return fmt.Sprintf("%.0f", v)
+	}
+	return fmt.Sprintf("%.2f", v)
+}
+
+// e.g. 1.5M
+func humanBytes(v float64) string {
+	units := []string{"", "K", "M", "G", "T"}
+	i := 0
+	for v >= 1024 && i < len(units)-1 {
+		v /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.1f%s", v, units[i])
+}
+
+func displayTraffic(servers []SERVER, traffic [][]BROKERTRAFFIC) {
+	for i, s := range servers {
+		fmt.Printf("%s :\n", s.cluster)
+		maxH := len("BROKER")
+		for _, bt := range traffic[i] {
+			maxH = max(maxH, len(bt.broker.label()))
+		}
+		fmt.Printf("  %-*s", maxH, "BROKER")
+		for _, m := range trafficMetrics {
+			fmt.Printf("  %*s", max(len(m.name), 7), m.name)
+		}
+		fmt.Println()
+		for _, bt := range traffic[i] {
+			fmt.Printf("  %-*s", maxH, bt.broker.label())
+			if logErr(bt.err) {
+				fmt.Println("  no metrics")
+				continue
+			}
+			for _, m := range trafficMetrics {
+				fmt.Printf("  %*s", max(len(m.name), 7), formatTraffic(m, bt.values[m.name]))
+			}
+			if len(bt.flags) > 0 {
+				fmt.Print("  HOT " + strings.Join(bt.flags, ", "))
+			}
+			fmt.Println()
+		}
+		hot := 0
+		for _, bt := range traffic[i] {
+			if len(bt.flags) > 0 {
+				hot++
+			}
+		}
+		addWatchMetric("hot", float64(hot))
+	}
+}
@@ -64,7 +64,7 @@ func printGroupAllNs(ns NAMESPACE) {
 func fillGivenGroupsAllNs() {
 	var wg sync.WaitGroup
 	for i := range Namespaces {
-		wg.Add(3)
+		wg.Add(3) // these schedule their own tasks
 		go func(i int) {
 			Namespaces[i].stateGivenGroups()
 			wg.Done()
@@ -86,19 +86,13 @@ func (n *NAMESPACE) getGivenGroups(s string) error {
 	if len(kpods) == 0 {
 		return errors.New("No kafka pods in " + n.Name())
 	}
-	var wg sync.WaitGroup
+	var tasks TASKS
 	for i := range n.Groups {
-		wg.Add(1)
-		go func(i int) {
+		i := i
+		tasks.Go(n.Name(), func() {
 			command := "bin/kafka-consumer-groups.sh --bootstrap-server localhost:9092 --describe --group " + n.Groups[i].name + " --verbose " + s
-			stdout, stderr, err := execToPod(command, "kafka", kpods[0].Name, n.Name(), nil)
-			if len(stderr) != 0 {
-				logErr(errors.New(stderr))
-				wg.Done()
-				return
-			}
+			stdout, _, err := execToPod(command, "kafka", kpods[0].Name, n.Name(), nil)
 			if logErr(err) {
-				wg.Done()
 				return
 			}
 			lines := make([]string, 0)
@@ -113,10 +107,9 @@ func (n *NAMESPACE) getGivenGroups(s string) error {
 			case OPT_GROUP_MEMBERS:
 				n.Groups[i].members = lines
 			}
-			wg.Done()
-		}(i)
+		})
 	}
-	wg.Wait()
+	tasks.Wait()
 	return nil
 }
 
@@ -126,19 +119,13 @@ func (n *NAMESPACE) stateGivenGroups() error {
 	if len(kpods) == 0 {
 		return errors.New("No kafka pods in " + n.Name())
 	}
-	var wg sync.WaitGroup
+	var tasks TASKS
 	for i := range n.Groups {
-		wg.Add(1)
-		go func(i int) {
+		i := i
+		tasks.Go(n.Name(), func() {
 			command := "bin/kafka-consumer-groups.sh --bootstrap-server localhost:9092 --describe --group " + n.Groups[i].name + " --verbose --state"
-			stdout, stderr, err := execToPod(command, "kafka", kpods[0].Name, n.Name(), nil)
-			if len(stderr) != 0 {
-				logErr(errors.New(stderr))
-				wg.Done()
-				return
-			}
+			stdout, _, err := execToPod(command, "kafka", kpods[0].Name, n.Name(), nil)
 			if logErr(err) {
-				wg.Done()
 				return
 			}
 			lines := strings.Split(stdout, "\n")
@@ -148,24 +135,22 @@ func (n *NAMESPACE) stateGivenGroups() error {
 					break
 				}
 			}
-			wg.Done()
-		}(i)
+		})
 	}
-	wg.Wait()
+	tasks.Wait()
 	return nil
 }
 
 func stateGroupsAllNs() {
-	var wg sync.WaitGroup
+	var tasks TASKS
 	for i := range Namespaces {
-		wg.Add(1)
-		go func(i int) {
+		i := i
+		tasks.Go(Namespaces[i].Name(), func() {
 			err := Namespaces[i].stateGroups()
 			logErr(err)
-			wg.Done()
-		}(i)
+		})
 	}
-	wg.Wait()
+	tasks.Wait()
 }
 
 // Describe all groups of the given namespace
@@ -194,23 +179,19 @@ func (n *NAMESPACE) stateGroups() error {
 			continue
 		}
 		currentPod = name
-		stdout, stderr, err := execToPod(command, "kafka", pod.Name, n.Name(), nil)
-		if len(stderr) != 0 {
-			logErr(errors.New(stderr))
-			continue
-		}
+		stdout, _, err := execToPod(command, "kafka", pod.Name, n.Name(), nil)
 		if err != nil {
 			return err
 		}
 		lines := strings.Split(stdout, "\n")
 		for _, line := range lines {
 			if !strings.Contains(line, "#MEMBERS") && strings.TrimSpace(line) != "" {
-				grps = append(grps, GROUP{state: line})
+				grps = append(grps, GROUP{name: strings.Fields(line)[0], state: line})
 			}
 		}
 	}
 	if len(grps) > 0 {
-		n.Groups = grps
+		n.Groups = selectGroups(grps)
 	}
 	return nil
 }
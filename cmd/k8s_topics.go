@@ -4,9 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"regexp"
-	"strconv"
 	"strings"
-	"sync"
 
 	"github.com/spf13/cobra"
 )
@@ -33,6 +31,8 @@ var kTopicCmd = &cobra.Command{
 				for _, podtd := range ns.PodTopicDetails {
 					nT, nP, nPR := sumTopicsDetails(podtd.TopicDetails)
 					fmt.Printf("%s : %s [t=%d p=%d pr=%d]\n", ns.Name(), podtd.podname, nT, nP, nPR)
+					addWatchMetric("topics", float64(nT))
+					addWatchMetric("partitions", float64(nP))
 					for _, t := range podtd.TopicDetails {
 						if topics == "" || inArray(tpcs, t.name) {
 							fmt.Printf("\t%s\n", t.name)
@@ -45,7 +45,12 @@ var kTopicCmd = &cobra.Command{
 				for _, podtd := range ns.PodTopicDetails {
 					nT, nP, nPR := sumTopicsDetails(podtd.TopicDetails)
 					fmt.Printf("%s : %s [t=%d p=%d pr=%d]\n", ns.Name(), podtd.podname, nT, nP, nPR)
+					addWatchMetric("topics", float64(nT))
+					addWatchMetric("partitions", float64(nP))
 					fmt.Println(toString(podtd.TopicDetails, tpcs))
+					if topics_balance {
+						fmt.Println(balanceToString(podtd.TopicDetails))
+					}
 				}
 			}
 		}
@@ -55,6 +60,7 @@ var kTopicCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(kTopicCmd)
 	// Cobra supports local flags which will only run when this command is called directly, e.g.:
+	kTopicCmd.Flags().BoolVarP(&topics_balance, "balance", "", false, "Show the replicas and leaders per broker, and the partitions not led by their preferred replica")
 }
 
 func sumTopicsDetails(at []topicDetails) (int, int, int) {
@@ -67,16 +73,16 @@ func sumTopicsDetails(at []topicDetails) (int, int, int) {
 }
 
 func describeTopicsAllNs() {
-	var wg sync.WaitGroup
+	var tasks TASKS
 	for i := range Namespaces {
-		wg.Add(1)
-		go func(i int) {
-			err := Namespaces[i].describeTopics()
-			logErr(err)
-			wg.Done()
-		}(i)
+		i := i
+		tasks.Go(Namespaces[i].Name(), func() {
+			if err := Namespaces[i].describeTopics(); err != nil {
+				clusterError(Namespaces[i].Name(), err)
+			}
+		})
 	}
-	wg.Wait()
+	tasks.Wait()
 }
 
 // Describe all topics of the given namespace for all clusters
@@ -104,49 +110,12 @@ func (n *NAMESPACE) describeTopics() error {
 			continue
 		}
 		currentPod = name
-		stdout, stderr, err := execToPod(command, "kafka", pod.Name, n.Name(), nil)
-		if len(stderr) != 0 {
-			return errors.New(stderr)
-		}
+		stdout, _, err := execToPod(command, "kafka", pod.Name, n.Name(), nil)
 		if err != nil {
 			return err
 		}
-		reOld := regexp.MustCompile(`^Topic:\s(.*)\s*PartitionCount:\s(\d*)\s*ReplicationFactor:\s(\d*)\s*Configs:\s(.*)$`)
-		reNew := regexp.MustCompile(`^Topic:\s(.*)(\s*TopicId:\s.*)\s*PartitionCount:\s(\d*)\s*ReplicationFactor:\s(\d*)\s*Configs:\s(.*)$`)
-		tds := make([]topicDetails, 0)
-		lines := strings.Split(stdout, "\n")
-		for i := 0; i < len(lines); {
-			line := strings.TrimSpace(lines[i])
-			if reNew.MatchString(line) {
-				as := reNew.FindStringSubmatch(line)
-				if len(as) == 6 {
-					p, _ := strconv.Atoi(as[3])
-					r, _ := strconv.Atoi(as[4])
-					partitions := make([]string, p)
-					for j := 0; j < p; j++ {
-						partitions[j] = lines[j+i+1]
-					}
-					details := topicDetails{name: strings.TrimSpace(as[1]), nbOfPartitions: p, replication: r, config: as[5], partitions: partitions}
-					tds = append(tds, details)
-					i += p + 1
-				}
-			} else if reOld.MatchString(line) {
-				as := reOld.FindStringSubmatch(line)
-				if len(as) == 5 {
-					p, _ := strconv.Atoi(as[2])
-					r, _ := strconv.Atoi(as[3])
-					partitions := make([]string, p)
-					for j := 0; j < p; j++ {
-						partitions[j] = lines[j+i+1]
-					}
-					details := topicDetails{name: strings.TrimSpace(as[1]), nbOfPartitions: p, replication: r, config: as[4], partitions: partitions}
-					tds = append(tds, details)
-					i += p + 1
-				}
-			} else {
-				i += 1
-			}
-		}
+		tds := parseTopicsDescribe(stdout)
+		tds = selectTopicDetails(tds)
 		sortTopicsDetails(&tds)
 		n.PodTopicDetails = append(n.PodTopicDetails, PODTOPICDETAILS{podname: currentPod, TopicDetails: tds})
 	}
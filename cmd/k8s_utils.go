@@ -3,12 +3,14 @@ package cmd
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
-	"os"
+	"math"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/mitchellh/go-homedir"
 	log "github.com/sirupsen/logrus"
@@ -58,20 +60,20 @@ func getConfigOrDie() {
 	var err error = nil
 	// use the current context in kubeconfig
 	config, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
-	if err != nil {
-		panic(err.Error())
-	}
+	logFatal(err)
 	log.Debug("Config : " + fmt.Sprintf("%v\n", config))
 }
 
 // Code working if connected through "oc login" because BearerToken is filled
 func getClientsetOrDie() {
+	if session != nil && clientset != nil { // kept by the shell
+		return
+	}
 	var err error
 	getConfigOrDie()
 	clientset, err = kubernetes.NewForConfig(config)
 	if err != nil {
-		fmt.Printf("error getting Kubernetes clientset: %v\n", err)
-		os.Exit(1)
+		logFatal(fmt.Errorf("error getting Kubernetes clientset: %v", err))
 	}
 	log.Debug("Clientcmd : " + fmt.Sprintf("%v\n", *clientset))
 }
@@ -89,10 +91,9 @@ func getPodsAllNs() {
 
 // Get all the pods of a given namespace
 func (n *NAMESPACE) getPods() {
-	pods, err := clientset.CoreV1().Pods(n.Ns.ObjectMeta.Name).List(context.Background(), metav1.ListOptions{})
+	pods, err := clientset.CoreV1().Pods(n.Ns.ObjectMeta.Name).List(rootCtx, metav1.ListOptions{})
 	if err != nil {
-		fmt.Printf("Error getting pods in %s: %v\n", n.Name(), err)
-		os.Exit(1)
+		logFatal(fmt.Errorf("Error getting pods in %s: %v", n.Name(), err))
 	}
 	if log.GetLevel() == log.DebugLevel {
 		for _, pod := range pods.Items {
@@ -104,10 +105,9 @@ func (n *NAMESPACE) getPods() {
 
 // Populate the variable Namespaces with the ones from ans, or all kafka namespaces if ans is empty
 func getKafkaNs(ans []string) {
-	ns, err := clientset.CoreV1().Namespaces().List(context.Background(), metav1.ListOptions{})
+	ns, err := clientset.CoreV1().Namespaces().List(rootCtx, metav1.ListOptions{})
 	if err != nil {
-		fmt.Printf("Error getting namespaces: %v\n", err)
-		os.Exit(1)
+		logFatal(fmt.Errorf("Error getting namespaces: %v", err))
 	}
 	Namespaces = make([]NAMESPACE, 0)
 	log.Debug("Namespaces:")
@@ -123,6 +123,51 @@ func getKafkaNs(ans []string) {
 }
 
 func execToPod(command, containerName, podName, _namespace string, stdin io.Reader) (string, string, error) {
+	return execToPodWith(true, command, containerName, podName, _namespace, stdin)
+}
+
+// Exec a command which changes the cluster : it is never retried
+func execMutatingToPod(command, containerName, podName, _namespace string, stdin io.Reader) (string, string, error) {
+	return execToPodWith(false, command, containerName, podName, _namespace, stdin)
+}
+
+func execToPodWith(retry bool, command, containerName, podName, _namespace string, stdin io.Reader) (string, string, error) {
+	if !retry && replayDir != "" {
+		return "", "", fmt.Errorf("%w : %s", errReplayMutating, command)
+	}
+	key := "exec " + _namespace + " " + podName + " " + containerName + " " + command
+	stdout, stderr, err := recorded(key, func() (string, string, error) {
+		return streamExecToPod(retry, command, containerName, podName, _namespace, stdin)
+	}, commandError(command))
+	if err != nil {
+		recordError(_namespace, err)
+	}
+	return stdout, stderr, err
+}
+
+func streamExecToPod(retry bool, command, containerName, podName, _namespace string, stdin io.Reader) (string, string, error) {
+	var stdout, stderr string
+	attempt := func() error {
+		var err error
+		stdout, stderr, err = streamToPod(command, containerName, podName, _namespace, stdin)
+		return err
+	}
+	var err error
+	if retry {
+		err = withRetries(podName+" : "+command, attempt)
+	} else {
+		err = attempt()
+	}
+	if err != nil {
+		return "", stderr, err
+	}
+	return stdout, stderr, nil
+}
+
+// One attempt of the command, until it ends or the context is done; the error is classified from the stderr
+func streamToPod(command, containerName, podName, _namespace string, stdin io.Reader) (string, string, error) {
+	ctx, cancel := commandContext()
+	defer cancel()
 	req := clientset.CoreV1().RESTClient().Post().Resource("pods").Name(podName).Namespace(_namespace).SubResource("exec")
 	scheme := runtime.NewScheme()
 	if err := v1.AddToScheme(scheme); err != nil {
@@ -131,7 +176,7 @@ func execToPod(command, containerName, podName, _namespace string, stdin io.Read
 
 	parameterCodec := runtime.NewParameterCodec(scheme)
 	req.VersionedParams(&v1.PodExecOptions{
-		Command:   strings.Fields(command),
+		Command:   podCommand(ctx, command),
 		Container: containerName,
 		Stdin:     stdin != nil,
 		Stdout:    true,
@@ -146,20 +191,39 @@ func execToPod(command, containerName, podName, _namespace string, stdin io.Read
 		return "", "", fmt.Errorf("error while creating Executor: %v", err)
 	}
 
+	// Buffers of this attempt only : an abandoned stream keeps writing them, so they are not read after ctx is done
 	var stdout, stderr bytes.Buffer
-	err = exec.Stream(remotecommand.StreamOptions{
-		Stdin:  stdin,
-		Stdout: &stdout,
-		Stderr: &stderr,
-		Tty:    false,
-	})
-	if err != nil {
-		return "", "", fmt.Errorf("error in Stream: %v", err)
+	done := make(chan error, 1)
+	go func() {
+		done <- exec.Stream(remotecommand.StreamOptions{
+			Stdin:  stdin,
+			Stdout: &stdout,
+			Stderr: &stderr,
+			Tty:    false,
+		})
+	}()
+	select {
+	case <-ctx.Done():
+		// the stream cannot be cancelled with this client-go; the command is stopped in the pod by the timeout wrapper
+		return "", "", ctxErr(ctx, command, ctx.Err())
+	case err := <-done:
+		if err != nil {
+			return "", stderr.String(), newKafkaError(command, stderr.String(), fmt.Errorf("error in Stream: %v", err))
+		}
 	}
-
 	return stdout.String(), stderr.String(), nil
 }
 
+// Wrap the command with the coreutils timeout so that it does not outlive its context (--cmd-timeout, --deadline) in the pod
+func podCommand(ctx context.Context, command string) []string {
+	end, ok := ctx.Deadline()
+	if !ok {
+		return strings.Fields(command)
+	}
+	seconds := max(1, int(math.Ceil(time.Until(end).Seconds()))) // timeout 0s would mean no timeout
+	return append([]string{"timeout", fmt.Sprintf("%ds", seconds)}, strings.Fields(command)...)
+}
+
 // Get the kafka pods only
 func (n NAMESPACE) getKafkaPods() []v1.Pod {
 	pods := make([]v1.Pod, 0)
@@ -172,9 +236,24 @@ func (n NAMESPACE) getKafkaPods() []v1.Pod {
 	return pods
 }
 
+// Name of a kafka broker pod of the namespace, restricted to the clusters given with --cluster if any
+func (n NAMESPACE) kafkaBrokerPod() (string, error) {
+	reK := regexp.MustCompile(`^(\S{4}\d{2,3})-kafka-\d+$`)
+	for _, p := range n.getKafkaPods() {
+		as := reK.FindStringSubmatch(p.Name)
+		if len(as) == 2 && (clustername == "" || inArray(strings.Split(clustername, ","), as[1])) {
+			return p.Name, nil
+		}
+	}
+	return "", errors.New("No kafka pods in " + n.Name())
+}
+
 // Get custom resource dynamically
 
 func getDynamicClientOrDie() {
+	if session != nil && dynset != nil {
+		return
+	}
 	getConfigOrDie()
 	dynset = dynamic.NewForConfigOrDie(config)
 }
@@ -185,7 +264,7 @@ func GetResourcesDynamically(group, version, resource, namespace string) ([]unst
 		Version:  version,
 		Resource: resource,
 	}
-	list, err := dynset.Resource(resourceId).Namespace(namespace).List(context.Background(), metav1.ListOptions{})
+	list, err := dynset.Resource(resourceId).Namespace(namespace).List(rootCtx, metav1.ListOptions{})
 
 	if err != nil {
 		return nil, err
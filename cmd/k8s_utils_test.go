@@ -0,0 +1,25 @@
+package cmd
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPodCommand(t *testing.T) {
+	command := "bin/kafka-topics.sh --bootstrap-server localhost:9092 --list"
+	if got := strings.Join(podCommand(context.Background(), command), " "); got != command {
+		t.Errorf("without deadline = %s", got)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 90*time.Second)
+	defer cancel()
+	if got := strings.Join(podCommand(ctx, command), " "); got != "timeout 90s "+command {
+		t.Errorf("with 90s left = %s", got)
+	}
+	ctx, cancel = context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	if got := podCommand(ctx, command); got[1] != "1s" {
+		t.Errorf("after the deadline = %v, want timeout 1s", got)
+	}
+}
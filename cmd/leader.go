@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// Represent the leader command
+var leaderCmd = &cobra.Command{
+	Use:   "leader",
+	Short: "[ERDING] Display the partitions not led by their preferred replica and trigger a preferred leader election",
+	Long: `List for each cluster the partitions whose leader is not the preferred (first) replica.
+  With the --elect option, display the kafka-leader-election.sh command (PREFERRED) to run for these partitions,
+  and run it only if --execute is given as well.
+	e.g. go run kstat.go -c bkt28 leader
+	e.g. go run kstat.go -c bkt28 -t topic1,topic2 leader --elect --execute `,
+
+	Run: func(cmd *cobra.Command, args []string) {
+		servers, err := initServers()
+		logFatal(err)
+		if strings.TrimSpace(topics) != "" {
+			tpcs := strings.ReplaceAll(strings.TrimSpace(topics), ",", "\n")
+			for i := range servers {
+				servers[i].topics = selectTopicList(tpcs)
+			}
+		} else {
+			getTopicsFromClusters(servers)
+		}
+		var tasks TASKS
+		parts := make([][]PARTITION, len(servers))
+		errs := make([]error, len(servers))
+		for i := range servers {
+			i := i
+			tasks.Go(servers[i].bootstrap, func() {
+				tds, err := getDetails(servers[i].bootstrap, strings.Split(strings.TrimSpace(servers[i].topics), "\n"))
+				if err != nil {
+					errs[i] = err
+				} else {
+					parts[i] = notPreferredLeaders(tds)
+				}
+			})
+		}
+		tasks.Wait()
+		for i, s := range servers {
+			if errs[i] != nil {
+				clusterError(s.cluster, errs[i])
+				continue
+			}
+			fmt.Printf("%s: %d partition(s) not led by their preferred replica\n", s.cluster, len(parts[i]))
+			if !short {
+				for _, p := range parts[i] {
+					fmt.Println("\t" + p.String())
+				}
+			}
+			if leader_elect && len(parts[i]) > 0 {
+				out, err := leader_election(s.bootstrap, parts[i])
+				if !logErr(err) {
+					fmt.Print(out)
+				}
+			}
+		}
+	},
+}
+
+var leader_elect, leader_execute bool
+
+func init() {
+	rootCmd.AddCommand(leaderCmd)
+	// Cobra supports local flags which will only run when this command is called directly, e.g.:
+	leaderCmd.Flags().BoolVarP(&leader_elect, "elect", "", false, "Trigger a preferred leader election for the partitions not led by their preferred replica (dry-run unless --execute)")
+	leaderCmd.Flags().BoolVarP(&leader_execute, "execute", "", false, "Really run the leader election")
+}
+
+type ELECTIONPARTITION struct {
+	Topic     string `json:"topic"`
+	Partition int    `json:"partition"`
+}
+
+type ELECTIONFILE struct {
+	Partitions []ELECTIONPARTITION `json:"partitions"`
+}
+
+// Run (or only display without --execute) kafka-leader-election.sh for the given partitions
+func leader_election(bootstrap string, parts []PARTITION) (string, error) {
+	args := []string{"--bootstrap-server", bootstrap, "--election-type", "PREFERRED"}
+	if strings.TrimSpace(topics) == "" && includes == "" && excludes == "" && !hideInternal { // no selection of the topics
+		args = append(args, "--all-topic-partitions")
+		if !leader_execute {
+			return "  dry-run : kafka-leader-election.sh " + strings.Join(args, " ") + "\n", nil
+		}
+	} else {
+		ef := ELECTIONFILE{Partitions: make([]ELECTIONPARTITION, len(parts))}
+		for i, p := range parts {
+			ef.Partitions[i] = ELECTIONPARTITION{Topic: p.topic, Partition: p.id}
+		}
+		data, err := json.Marshal(ef)
+		if err != nil {
+			return "", err
+		}
+		if !leader_execute {
+			return "  dry-run : kafka-leader-election.sh " + strings.Join(args, " ") + " --path-to-json-file FILE\n  FILE: " + string(data) + "\n", nil
+		}
+		f, err := os.CreateTemp("", "kstat-election-*.json")
+		if err != nil {
+			return "", err
+		}
+		defer os.Remove(f.Name())
+		_, err = f.Write(data)
+		f.Close()
+		if err != nil {
+			return "", err
+		}
+		args = append(args, "--path-to-json-file", f.Name())
+	}
+	return runMutatingCommand("kafka-leader-election.sh", args...)
+}
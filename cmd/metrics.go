@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// One sample of the prometheus text format, e.g. kafka_network_requestmetrics_requests_total{request="Produce",} 1234.0
+type SAMPLE struct {
+	name   string
+	labels map[string]string
+	value  float64
+}
+
+// Parse the samples of a /metrics page; the comments and the malformed lines are skipped
+func parsePrometheus(body string) []SAMPLE {
+	samples := make([]SAMPLE, 0)
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		s, err := parseSample(line)
+		if err == nil {
+			samples = append(samples, s)
+		}
+	}
+	return samples
+}
+
+func parseSample(line string) (SAMPLE, error) {
+	s := SAMPLE{labels: make(map[string]string)}
+	i := strings.IndexAny(line, "{ \t")
+	if i <= 0 {
+		return s, errors.New("No value in " + line)
+	}
+	s.name, line = line[:i], line[i:]
+	if line[0] == '{' {
+		rest, err := parseLabels(line[1:], s.labels)
+		if err != nil {
+			return s, err
+		}
+		line = rest
+	}
+	fields := strings.Fields(line) // value [timestamp]
+	if len(fields) == 0 {
+		return s, errors.New("No value for " + s.name)
+	}
+	v, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return s, err
+	}
+	s.value = v
+	return s, nil
+}
+
+// Parse name="value" pairs until the closing brace, and return what follows it
+func parseLabels(line string, labels map[string]string) (string, error) {
+	for {
+		line = strings.TrimLeft(line, ", ")
+		if strings.HasPrefix(line, "}") {
+			return line[1:], nil
+		}
+		eq := strings.Index(line, "=\"")
+		if eq <= 0 {
+			return "", errors.New("Bad labels : " + line)
+		}
+		name := strings.TrimSpace(line[:eq])
+		var value strings.Builder
+		i := eq + 2
+		for ; i < len(line) && line[i] != '"'; i++ {
+			if line[i] == '\\' && i+1 < len(line) {
+				i++
+				switch line[i] {
+				case 'n':
+					value.WriteByte('\n')
+				default:
+					value.WriteByte(line[i])
+				}
+				continue
+			}
+			value.WriteByte(line[i])
+		}
+		if i >= len(line) {
+			return "", errors.New("Unterminated label " + name)
+		}
+		labels[name] = value.String()
+		line = line[i+1:]
+	}
+}
+
+// Sum of the samples of the metric having the given labels; the per topic samples are ignored when a broker wide sample exists.
+// Return NaN if the metric is not exported.
+func sampleValue(samples []SAMPLE, name string, labels map[string]string) float64 {
+	total, wide, found := 0., 0., false
+	hasWide := false
+	for _, s := range samples {
+		if s.name != name || !hasLabels(s, labels) {
+			continue
+		}
+		found = true
+		total += s.value
+		if _, exist := s.labels["topic"]; !exist {
+			wide += s.value
+			hasWide = true
+		}
+	}
+	switch {
+	case !found:
+		return math.NaN()
+	case hasWide:
+		return wide
+	}
+	return total
+}
+
+func hasLabels(s SAMPLE, labels map[string]string) bool {
+	for k, v := range labels {
+		if s.labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Sum of the samples of the metric kept by the filter, NaN if none
+func sampleSum(samples []SAMPLE, name string, keep func(SAMPLE) bool) float64 {
+	total, found := 0., false
+	for _, s := range samples {
+		if s.name == name && keep(s) {
+			total += s.value
+			found = true
+		}
+	}
+	if !found {
+		return math.NaN()
+	}
+	return total
+}
@@ -0,0 +1,293 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	homedir "github.com/mitchellh/go-homedir"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// Represent the alert command
+var alertCmd = &cobra.Command{
+	Use:   "alert",
+	Short: "[ERDING] Send webhook notifications when health, lag or disk usage cross thresholds",
+	Long: `Check the health (URP, UMISR, UNAV), the consumer lag and the kafkadata disk usage of the clusters,
+  and POST a JSON payload (or a Slack message with --slack) to the webhooks for each new breach.
+  The breaches already notified are kept in a state file, so that a breach is sent only once,
+  and a "resolved" message is sent when the condition clears.
+  The webhooks may also be defined in the config file $HOME/.kstat (key webhooks).
+	e.g. go run kstat.go --git-branch ERDING_PRD alert --webhook https://hooks.slack.com/services/XXX --slack `,
+
+	Run: func(cmd *cobra.Command, args []string) {
+		urls := webhookUrls()
+		if len(urls) == 0 {
+			logFatal(errors.New("No webhook defined : please use the --webhook command line option"))
+		}
+		servers, err := initServers()
+		logFatal(err)
+		state, err := loadAlertState(alertStateFile())
+		logFatal(err)
+		alerts, checked, unchecked := collectAlerts(servers)
+		firing, resolved := diffAlerts(state, alerts, checked, unchecked)
+		failed := make(map[string]bool) // not notified, to be sent again on the next run
+		for _, a := range append(firing, resolved...) {
+			if !notifyAll(urls, a) {
+				failed[a.Key] = true
+			}
+		}
+		fmt.Printf("%d breach(es), %d new, %d resolved\n", len(alerts), len(firing), len(resolved))
+		logErr(saveAlertState(alertStateFile(), alerts, state, checked, unchecked, failed))
+	},
+}
+
+var alert_webhooks, alert_stateFile string
+var alert_slack bool
+var alert_maxLag int64
+var alert_maxDisk float64
+
+func init() {
+	rootCmd.AddCommand(alertCmd)
+	// Cobra supports local flags which will only run when this command is called directly, e.g.:
+	alertCmd.Flags().StringVarP(&alert_webhooks, "webhook", "", "", "Webhook URLs using comma as separator")
+	alertCmd.Flags().BoolVarP(&alert_slack, "slack", "", false, "Send Slack-compatible messages")
+	alertCmd.Flags().StringVarP(&alert_stateFile, "state-file", "", "", "File keeping the breaches already notified (default $HOME/.kstat_alerts.json)")
+	alertCmd.Flags().Int64VarP(&alert_maxLag, "max-lag", "", 100000, "Breach when the lag of a group is above this value")
+	alertCmd.Flags().Float64VarP(&alert_maxDisk, "max-disk", "", 85, "Breach when the kafkadata disk usage of a broker is above this percentage")
+}
+
+const (
+	ALERT_FIRING   = "firing"
+	ALERT_RESOLVED = "resolved"
+)
+
+// A threshold breach; the key identifies the breach across runs
+type ALERT struct {
+	Key     string  `json:"key"`
+	Status  string  `json:"status"`
+	Cluster string  `json:"cluster"`
+	Check   string  `json:"check"`
+	Message string  `json:"message"`
+	Value   float64 `json:"value"`
+	Since   string  `json:"since"`
+}
+
+func webhookUrls() []string {
+	urls := make([]string, 0)
+	for _, u := range strings.Split(alert_webhooks, ",") {
+		if strings.TrimSpace(u) != "" {
+			urls = append(urls, strings.TrimSpace(u))
+		}
+	}
+	return append(urls, viper.GetStringSlice("webhooks")...)
+}
+
+func alertStateFile() string {
+	if alert_stateFile != "" {
+		return alert_stateFile
+	}
+	home, err := homedir.Dir()
+	logFatal(err)
+	return filepath.Join(home, ".kstat_alerts.json")
+}
+
+func alertKey(cluster, check, key string) string {
+	return cluster + "/" + check + "/" + key
+}
+
+func newAlert(cluster, check, key, message string, value float64) ALERT {
+	return ALERT{Key: alertKey(cluster, check, key), Status: ALERT_FIRING, Cluster: cluster, Check: check, Message: message, Value: value}
+}
+
+// Check all clusters and return the current breaches, along with the clusters which could be checked
+// and the keys of the breaches which could not be checked in these clusters (e.g. the disk of a broker without metrics)
+func collectAlerts(servers []SERVER) ([]ALERT, map[string]bool, map[string]bool) {
+	nodeMetrics, kafkaMetrics := initNodeMetrics(), initKafkaMetrics()
+	alerts := make([][]ALERT, len(servers))
+	ok := make([]bool, len(servers))
+	skipped := make([][]string, len(servers))
+	var wg sync.WaitGroup
+	for i := range servers {
+		wg.Add(1)
+		go func(i int) { // the commands are run by the scheduler
+			alerts[i], skipped[i], ok[i] = clusterAlerts(&servers[i], nodeMetrics, kafkaMetrics)
+			wg.Done()
+		}(i)
+	}
+	wg.Wait()
+	res := make([]ALERT, 0)
+	checked := make(map[string]bool)
+	unchecked := make(map[string]bool)
+	for i, s := range servers {
+		res = append(res, alerts[i]...)
+		checked[s.cluster] = ok[i]
+		for _, k := range skipped[i] {
+			unchecked[k] = true
+		}
+	}
+	return res, checked, unchecked
+}
+
+// Return the breaches of the cluster, the keys of the breaches which could not be checked,
+// and false if one of the checks of the whole cluster failed
+func clusterAlerts(s *SERVER, nodeMetrics, kafkaMetrics []string) ([]ALERT, []string, bool) {
+	alerts := make([]ALERT, 0)
+	unchecked := make([]string, 0)
+	h, err := collectHealth(s.bootstrap, true)
+	if logErr(err) {
+		return alerts, unchecked, false
+	}
+	if h.nURP > 0 {
+		alerts = append(alerts, newAlert(s.cluster, "urp", "", fmt.Sprintf("%d under replicated partitions", h.nURP), float64(h.nURP)))
+	}
+	if h.nUMISR > 0 {
+		alerts = append(alerts, newAlert(s.cluster, "umisr", "", fmt.Sprintf("%d under min isr partitions", h.nUMISR), float64(h.nUMISR)))
+	}
+	if h.nUNAV > 0 {
+		alerts = append(alerts, newAlert(s.cluster, "unav", "", fmt.Sprintf("%d unavailable partitions", h.nUNAV), float64(h.nUNAV)))
+	}
+	var out string
+	schedule(s.bootstrap, func() {
+		out, err = group_offsets_cmd(s.bootstrap)
+	})
+	if logErr(err) {
+		return alerts, unchecked, false
+	}
+	for _, l := range groupLags(parseGroupOffsets(out)) {
+		if l.Lag > alert_maxLag {
+			alerts = append(alerts, newAlert(s.cluster, "lag", l.Group, fmt.Sprintf("group %s lag %d", l.Group, l.Lag), float64(l.Lag)))
+		}
+	}
+	fillBrokerMetrics(s, nodeMetrics, kafkaMetrics)
+	for _, bm := range s.brokermetrics {
+		d := computeKafkadata(bm.metrics)
+		switch {
+		case d < 0: // no metrics : a previous breach is neither resolved nor forgotten
+			unchecked = append(unchecked, alertKey(s.cluster, "disk", bm.host))
+		case d > alert_maxDisk:
+			alerts = append(alerts, newAlert(s.cluster, "disk", bm.host, fmt.Sprintf("broker %s kafkadata disk usage %.1f%%", bm.label(), d), d))
+		}
+	}
+	return alerts, unchecked, true
+}
+
+// Return the new breaches, and the breaches of the state which are resolved (only for the clusters which could be checked,
+// and not for the breaches which could not be checked)
+func diffAlerts(state map[string]ALERT, alerts []ALERT, checked, unchecked map[string]bool) ([]ALERT, []ALERT) {
+	current := make(map[string]bool)
+	firing := make([]ALERT, 0)
+	for i, a := range alerts {
+		current[a.Key] = true
+		if old, exist := state[a.Key]; exist {
+			alerts[i].Since = old.Since
+		} else {
+			alerts[i].Since = time.Now().Format(time.RFC3339)
+			firing = append(firing, alerts[i])
+		}
+	}
+	resolved := make([]ALERT, 0)
+	for k, a := range state {
+		if !current[k] && checked[a.Cluster] && !unchecked[k] {
+			a.Status = ALERT_RESOLVED
+			resolved = append(resolved, a)
+		}
+	}
+	sort.Slice(resolved, func(i, j int) bool { return resolved[i].Key < resolved[j].Key })
+	return firing, resolved
+}
+
+func loadAlertState(filename string) (map[string]ALERT, error) {
+	state := make(map[string]ALERT)
+	data, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, &state)
+	return state, err
+}
+
+// Keep the current breaches, plus the old ones which could not be checked.
+// The notifications which failed are not recorded, so that they are sent again on the next run
+func saveAlertState(filename string, alerts []ALERT, old map[string]ALERT, checked, unchecked, failed map[string]bool) error {
+	state := make(map[string]ALERT)
+	for k, a := range old {
+		if !checked[a.Cluster] || unchecked[k] || failed[k] {
+			state[k] = a
+		}
+	}
+	for _, a := range alerts {
+		if _, exist := old[a.Key]; failed[a.Key] && !exist {
+			continue
+		}
+		state[a.Key] = a
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, data, 0600)
+}
+
+// Send the alert to all webhooks; return false if one of them failed
+func notifyAll(urls []string, a ALERT) bool {
+	var payload interface{} = a
+	if alert_slack {
+		payload = slackMessage(a)
+	}
+	ok := true
+	for _, u := range urls {
+		if err := sendWebhook(u, payload); err != nil {
+			log.Error("webhook " + u + " : " + err.Error())
+			ok = false
+		}
+	}
+	return ok
+}
+
+func slackMessage(a ALERT) map[string]string {
+	icon := ":red_circle:"
+	if a.Status == ALERT_RESOLVED {
+		icon = ":large_green_circle:"
+	}
+	return map[string]string{"text": fmt.Sprintf("%s [%s] %s %s : %s (since %s)", icon, strings.ToUpper(a.Status), a.Cluster, a.Check, a.Message, a.Since)}
+}
+
+// POST the payload as JSON to the given url
+func sendWebhook(url string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: time.Duration(httpTimeout) * time.Millisecond}
+	log.Debug("Send webhook to " + url + " : " + string(body))
+	req, err := http.NewRequestWithContext(rootCtx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	r, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+	io.Copy(io.Discard, r.Body)
+	if r.StatusCode < 200 || r.StatusCode >= 300 {
+		return errors.New("bad status " + r.Status)
+	}
+	return nil
+}
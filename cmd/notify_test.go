@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// A webhook receiver keeping the bodies it got, answering with the given status
+func webhookServer(t *testing.T, status int) (*httptest.Server, func() []string) {
+	t.Helper()
+	var mu sync.Mutex
+	bodies := make([]string, 0)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("got %s with content type %q, want a JSON POST", r.Method, r.Header.Get("Content-Type"))
+		}
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(body))
+		mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string{}, bodies...)
+	}
+}
+
+func TestSendWebhookPayloads(t *testing.T) {
+	srv, bodies := webhookServer(t, http.StatusOK)
+	firing := newAlert("PRD", "urp", "", "3 under replicated partitions", 3)
+	firing.Since = "2026-10-19T10:00:00Z"
+	resolved := firing
+	resolved.Status = ALERT_RESOLVED
+	for _, a := range []ALERT{firing, resolved} {
+		if !notifyAll([]string{srv.URL}, a) {
+			t.Fatalf("%s alert not sent", a.Status)
+		}
+	}
+	got := bodies()
+	if len(got) != 2 {
+		t.Fatalf("%d requests, want 2", len(got))
+	}
+	for i, status := range []string{ALERT_FIRING, ALERT_RESOLVED} {
+		var a ALERT
+		if err := json.Unmarshal([]byte(got[i]), &a); err != nil {
+			t.Fatal(err)
+		}
+		if a.Status != status || a.Key != "PRD/urp/" || a.Value != 3 || a.Since != firing.Since {
+			t.Errorf("payload %d = %+v, want a %s alert PRD/urp/", i, a, status)
+		}
+	}
+}
+
+func TestSendWebhookSlack(t *testing.T) {
+	srv, bodies := webhookServer(t, http.StatusOK)
+	alert_slack = true
+	defer func() { alert_slack = false }()
+	a := newAlert("PRD", "lag", "g1", "group g1 lag 200000", 200000)
+	a.Since = "2026-10-19T10:00:00Z"
+	notifyAll([]string{srv.URL}, a)
+	a.Status = ALERT_RESOLVED
+	notifyAll([]string{srv.URL}, a)
+	want := []string{
+		":red_circle: [FIRING] PRD lag : group g1 lag 200000 (since 2026-10-19T10:00:00Z)",
+		":large_green_circle: [RESOLVED] PRD lag : group g1 lag 200000 (since 2026-10-19T10:00:00Z)",
+	}
+	got := bodies()
+	if len(got) != len(want) {
+		t.Fatalf("%d requests, want %d", len(got), len(want))
+	}
+	for i := range want {
+		var msg map[string]string
+		if err := json.Unmarshal([]byte(got[i]), &msg); err != nil {
+			t.Fatal(err)
+		}
+		if len(msg) != 1 || msg["text"] != want[i] {
+			t.Errorf("message %d = %v, want text %q", i, msg, want[i])
+		}
+	}
+}
+
+func TestSendWebhookBadStatus(t *testing.T) {
+	srv, _ := webhookServer(t, http.StatusInternalServerError)
+	err := sendWebhook(srv.URL, newAlert("PRD", "urp", "", "1 under replicated partitions", 1))
+	if err == nil || !strings.Contains(err.Error(), "500") {
+		t.Errorf("error = %v, want a bad status 500", err)
+	}
+	ok, _ := webhookServer(t, http.StatusNoContent)
+	if notifyAll([]string{ok.URL, srv.URL}, newAlert("PRD", "urp", "", "", 1)) {
+		t.Error("notifyAll succeeded although one webhook failed")
+	}
+}
+
+func TestDiffAlertsUncheckedBroker(t *testing.T) {
+	disk := newAlert("PRD", "disk", "bk1", "broker #1 bk1 kafkadata disk usage 90.0%", 90)
+	urp := newAlert("PRD", "urp", "", "1 under replicated partitions", 1)
+	state := map[string]ALERT{disk.Key: disk, urp.Key: urp}
+	checked := map[string]bool{"PRD": true}
+	unchecked := map[string]bool{disk.Key: true} // the metrics of bk1 could not be scraped
+	firing, resolved := diffAlerts(state, []ALERT{}, checked, unchecked)
+	if len(firing) != 0 || len(resolved) != 1 || resolved[0].Key != urp.Key {
+		t.Errorf("firing %v, resolved %v : want only %s resolved", firing, resolved, urp.Key)
+	}
+	file := t.TempDir() + "/alerts.json"
+	if err := saveAlertState(file, []ALERT{}, state, checked, unchecked, map[string]bool{}); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := loadAlertState(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, exist := saved[disk.Key]; !exist || len(saved) != 1 {
+		t.Errorf("state %v, want only %s kept", saved, disk.Key)
+	}
+}
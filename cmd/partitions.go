@@ -1,17 +1,13 @@
 package cmd
 
 import (
-	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"os/exec"
 	"sort"
 	"strconv"
 	"strings"
-	"sync"
 
-	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
@@ -25,16 +21,16 @@ var partitionsCmd = &cobra.Command{
 		partitions_check()
 		servers, err := initServers()
 		logFatal(err)
-		var wg sync.WaitGroup
+		var tasks TASKS
 		for i := range servers {
-			wg.Add(1)
-			go func(s *SERVER) {
+			s := &servers[i]
+			tasks.Go(s.bootstrap, func() {
 				buildLogDir(s)
-				wg.Done()
-			}(&servers[i])
+			})
 		}
-		wg.Wait()
+		tasks.Wait()
 		for _, s := range servers {
+			addWatchMetric("partitions", float64(sum(computeNPartitions(s.logdirs))))
 			if short { // Pretty printing
 				displayLogDirs(s)
 			} else { // Raw printing
@@ -69,20 +65,10 @@ func partitions_cmd(brokers string) (string, error) {
 	if err := check_conn(brokers); err != nil {
 		return "", errors.New("No connection to the VMs\n" + err.Error())
 	}
-	var ecmd *exec.Cmd
 	if brokerList != "" {
-		log.Debug("Run command : kafka-log-dirs.sh --bootstrap-server " + brokers + " --describe --broker-list " + brokerList)
-		ecmd = exec.Command("kafka-log-dirs.sh", "--bootstrap-server", brokers, "--describe", "--broker-list", brokerList)
-	} else {
-		log.Debug("Run command : kafka-log-dirs.sh --bootstrap-server " + brokers + " --describe")
-		ecmd = exec.Command("kafka-log-dirs.sh", "--bootstrap-server", brokers, "--describe")
+		return runCommand("kafka-log-dirs.sh", "--bootstrap-server", brokers, "--describe", "--broker-list", brokerList)
 	}
-	var out bytes.Buffer
-	ecmd.Stdout = &out
-	if err := ecmd.Run(); err != nil {
-		return "", err
-	}
-	return out.String(), nil
+	return runCommand("kafka-log-dirs.sh", "--bootstrap-server", brokers, "--describe")
 }
 
 func buildLogDir(server *SERVER) error {
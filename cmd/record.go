@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/memfs"
+	log "github.com/sirupsen/logrus"
+)
+
+var recordDir, replayDir string
+
+func init() {
+	rootCmd.PersistentFlags().StringVarP(&recordDir, "record", "", "", "Directory where the outputs of the kafka scripts, metrics requests, git inventories and pod execs are recorded")
+	rootCmd.PersistentFlags().StringVarP(&replayDir, "replay", "", "", "Directory of a previous --record, whose outputs are served instead of touching the network")
+}
+
+// Error of the commands which change the cluster, refused with --replay
+var errReplayMutating = errors.New("NOT RUN WITH --replay")
+
+// The raw output of one call, stored in one JSON file per key
+type RECORDING struct {
+	Key    string `json:"key"`
+	Stdout string `json:"stdout"`
+	Stderr string `json:"stderr,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// File of the recording : a readable prefix and a hash of the whole key (command and target)
+func recordingFile(dir, key string) string {
+	h := sha1.Sum([]byte(key))
+	prefix := regexp.MustCompile(`[^A-Za-z0-9._-]+`).ReplaceAllString(key, "_")
+	if len(prefix) > 60 {
+		prefix = prefix[:60]
+	}
+	return filepath.Join(dir, prefix+"-"+hex.EncodeToString(h[:8])+".json")
+}
+
+func loadRecording(key string) (RECORDING, error) {
+	var rec RECORDING
+	data, err := os.ReadFile(recordingFile(replayDir, key))
+	if errors.Is(err, os.ErrNotExist) {
+		return rec, errors.New("No recording for " + key)
+	}
+	if err != nil {
+		return rec, err
+	}
+	err = json.Unmarshal(data, &rec)
+	return rec, err
+}
+
+func saveRecording(rec RECORDING) {
+	if err := os.MkdirAll(recordDir, 0755); logErr(err) {
+		return
+	}
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if logErr(err) {
+		return
+	}
+	logErr(os.WriteFile(recordingFile(recordDir, rec.Key), data, 0644))
+}
+
+// Run the call, or serve it from the --replay directory; the result is stored in the --record directory.
+// The error of a replayed call is rebuilt by toErr from the recorded message and stderr.
+func recorded(key string, run func() (string, string, error), toErr func(msg, stderr string) error) (string, string, error) {
+	if replayDir != "" {
+		log.Debug("Replay " + key)
+		rec, err := loadRecording(key)
+		if err != nil {
+			return "", "", err
+		}
+		if rec.Error != "" {
+			return rec.Stdout, rec.Stderr, toErr(rec.Error, rec.Stderr)
+		}
+		return rec.Stdout, rec.Stderr, nil
+	}
+	stdout, stderr, err := run()
+	if recordDir != "" {
+		rec := RECORDING{Key: key, Stdout: stdout, Stderr: stderr}
+		var ke *KAFKAERROR
+		if errors.As(err, &ke) { // keep the raw error, the replay classifies it again
+			rec.Error, rec.Stderr = ke.err.Error(), ke.stderr
+		} else if err != nil {
+			rec.Error = err.Error()
+		}
+		saveRecording(rec)
+	}
+	return stdout, stderr, err
+}
+
+func plainError(msg, _ string) error {
+	return errors.New(msg)
+}
+
+// Rebuild the error of a replayed command
+func commandError(command string) func(msg, stderr string) error {
+	return func(msg, stderr string) error {
+		switch {
+		case strings.HasPrefix(msg, errTimeout.Error()):
+			return fmt.Errorf("%w : %s", errTimeout, command)
+		case strings.HasPrefix(msg, errCanceled.Error()):
+			return fmt.Errorf("%w : %s", errCanceled, command)
+		}
+		return newKafkaError(command, stderr, errors.New(msg))
+	}
+}
+
+// Serialize the top-level files of the git repository (the inventories)
+func filesOf(fs billy.Filesystem) (string, error) {
+	arr, err := fs.ReadDir("/")
+	if err != nil {
+		return "", err
+	}
+	files := make(map[string]string)
+	for _, a := range arr {
+		if a.IsDir() {
+			continue
+		}
+		f, err := fs.Open(a.Name())
+		if err != nil {
+			return "", err
+		}
+		data, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			return "", err
+		}
+		files[a.Name()] = string(data)
+	}
+	data, err := json.Marshal(files)
+	return string(data), err
+}
+
+// Rebuild an in-memory repository from the serialized files
+func filesToFs(content string) (billy.Filesystem, error) {
+	files := make(map[string]string)
+	if err := json.Unmarshal([]byte(content), &files); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fs := memfs.New()
+	for _, name := range names {
+		f, err := fs.Create(name)
+		if err != nil {
+			return nil, err
+		}
+		_, err = f.Write([]byte(files[name]))
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return fs, nil
+}
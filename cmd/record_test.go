@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "Rewrite the golden files of testdata")
+
+// The bootstrap servers of the recordings of testdata/replay
+const fixtureBootstrap = "bk1.example.net:9092"
+
+// Serve the recordings of testdata/replay, as with --replay
+func replayTestdata(t *testing.T) {
+	t.Helper()
+	saved := replayDir
+	replayDir = filepath.Join("testdata", "replay")
+	t.Cleanup(func() { replayDir = saved })
+}
+
+// Use the given content as the --inv inventory file
+func testInventory(t *testing.T, content string) {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "inv")
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	saved := invFile
+	invFile = file
+	t.Cleanup(func() { invFile = saved })
+}
+
+// Compare with testdata/<name>.golden, or rewrite it with -update
+func checkGolden(t *testing.T, name, got string) {
+	t.Helper()
+	file := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := os.WriteFile(file, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != string(want) {
+		t.Errorf("%s differs from %s :\n%s", name, file, got)
+	}
+}
+
+// Return what f writes on the standard output
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = saved }()
+	done := make(chan string)
+	go func() {
+		out, _ := io.ReadAll(r)
+		done <- string(out)
+	}()
+	f()
+	w.Close()
+	return <-done
+}
+
+func TestReplayRefusesMutatingCommands(t *testing.T) {
+	replayTestdata(t)
+	_, err := runMutatingCommand("kafka-leader-election.sh", "--bootstrap-server", fixtureBootstrap, "--election-type", "PREFERRED", "--all-topic-partitions")
+	if !errors.Is(err, errReplayMutating) {
+		t.Errorf("error = %v, want %v", err, errReplayMutating)
+	}
+	_, _, err = execMutatingToPod("bin/kafka-consumer-groups.sh --delete --group g1", "kafka", "kafka-0", "ns1", nil)
+	if !errors.Is(err, errReplayMutating) {
+		t.Errorf("error = %v, want %v", err, errReplayMutating)
+	}
+	if _, err := runCommand("kafka-acls.sh", "--bootstrap-server", fixtureBootstrap, "--list"); err != nil {
+		t.Errorf("the read only commands are replayed : %v", err)
+	}
+}
+
+func TestReplayInventoryRecording(t *testing.T) {
+	testInventory(t, "[bkt28]\nbktv2803.os.amadeus.net\nbktv2801.os.amadeus.net\nbktv2802.os.amadeus.net\nbktv2804.os.amadeus.net\n")
+	bootstrap := "bktv2801.os.amadeus.net:9092,bktv2802.os.amadeus.net:9092,bktv2803.os.amadeus.net:9092,bktv2804.os.amadeus.net:9092"
+	replayFixtures(t, map[string]string{
+		"conn bktv2801.os.amadeus.net:9092":                             "",
+		"cmd kafka-acls.sh --bootstrap-server " + bootstrap + " --list": "acls",
+	})
+	for i := 0; i < 2; i++ { // the hosts of the inventory come from a map
+		servers, err := LoadInvFile()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(servers) != 1 || servers[0].bootstrap != bootstrap {
+			t.Fatalf("servers = %v, want bkt28 with %s", servers, bootstrap)
+		}
+		if out, err := acls_cmd(servers[0].bootstrap); err != nil || out != "acls" {
+			t.Errorf("replay = %q, %v", out, err)
+		}
+	}
+}
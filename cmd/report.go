@@ -0,0 +1,361 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// Represent the report command
+var reportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "[ERDING] Write a HTML or Markdown report of all clusters of one or more git branches",
+	Long: `Run info, health, partition balance and group lag over all clusters of the given git branches
+  (--git-branch, comma separated, or all known branches if not set) and write one self-contained report
+  with a summary table per branch, red/amber flags and a detail section per cluster.
+	e.g. go run kstat.go --git-branch ERDING_DEV,ERDING_TL1 --git-login jimbert report --format html -o report.html `,
+
+	Run: func(cmd *cobra.Command, args []string) {
+		if report_format != "html" && report_format != "md" {
+			logFatal(errors.New("Bad value for format. Allowed values are html and md"))
+		}
+		reports := make([]BRANCHREPORT, 0)
+		for _, branch := range reportBranches() {
+			servers, err := buildServersFromBranch(branch)
+			if logErr(err) {
+				continue
+			}
+			registerServers(servers)
+			reports = append(reports, BRANCHREPORT{Branch: branch, Clusters: collectReports(servers)})
+		}
+		var w io.Writer = os.Stdout
+		if report_outfile != "" {
+			f, err := os.Create(report_outfile)
+			logFatal(err)
+			defer f.Close()
+			w = f
+		}
+		logFatal(writeReport(w, reports))
+	},
+}
+
+var report_format, report_outfile string
+var report_diskWarn, report_diskCrit float64
+var report_lagWarn, report_lagCrit int64
+
+func init() {
+	rootCmd.AddCommand(reportCmd)
+	// Cobra supports local flags which will only run when this command is called directly, e.g.:
+	reportCmd.Flags().StringVarP(&report_format, "format", "", "html", "Format of the report : html or md")
+	reportCmd.Flags().StringVarP(&report_outfile, "outfile", "o", "", "Output file name (default stdout)")
+	reportCmd.Flags().Float64VarP(&report_diskWarn, "disk-warn", "", 70, "Amber flag when the kafkadata disk usage is above this percentage")
+	reportCmd.Flags().Float64VarP(&report_diskCrit, "disk-crit", "", 85, "Red flag when the kafkadata disk usage is above this percentage")
+	reportCmd.Flags().Int64VarP(&report_lagWarn, "lag-warn", "", 10000, "Amber flag when the lag of a group is above this value")
+	reportCmd.Flags().Int64VarP(&report_lagCrit, "lag-crit", "", 100000, "Red flag when the lag of a group is above this value")
+}
+
+const (
+	STATUS_GREEN = "green"
+	STATUS_AMBER = "amber"
+	STATUS_RED   = "red"
+)
+
+type BROKERROW struct {
+	Broker  string
+	Version string
+	Disk    float64 // percentage of /opt/kafkadata used
+	SizeG   float64
+	Parts   int
+}
+
+type CLUSTERREPORT struct {
+	Cluster                 string
+	Topics, Partitions      int
+	URP, UMISR, AMISR, UNAV int
+	Brokers                 []BROKERROW
+	Lags                    []GROUPLAG // groups sorted by decreasing lag
+	TotalLag                int64
+	MaxDisk, Imbalance      float64
+	Status                  string
+	Flags, Errors           []string
+}
+
+type BRANCHREPORT struct {
+	Branch   string
+	Clusters []CLUSTERREPORT
+}
+
+// The branches given with --git-branch (comma separated), or all known branches
+func reportBranches() []string {
+	if strings.TrimSpace(gitBranch) != "" {
+		return strings.Split(gitBranch, ",")
+	}
+	return branchs[:]
+}
+
+// Collect info, health and lags for all servers
+func collectReports(servers []SERVER) []CLUSTERREPORT {
+	nodeMetrics, kafkaMetrics := initNodeMetrics(), initKafkaMetrics()
+	fillInfo(servers, nodeMetrics, kafkaMetrics)
+	reports := make([]CLUSTERREPORT, len(servers))
+	var wg sync.WaitGroup
+	for i := range servers {
+		wg.Add(1)
+		go func(i int) { // the commands are run by the scheduler
+			reports[i] = collectReport(servers[i])
+			wg.Done()
+		}(i)
+	}
+	wg.Wait()
+	return reports
+}
+
+func collectReport(s SERVER) CLUSTERREPORT {
+	cr := CLUSTERREPORT{Cluster: s.cluster, Topics: numberOfTopics(s.topics)}
+	parts := computeNPartitions(s.logdirs)
+	cr.Partitions = sum(parts)
+	perBroker := partitionsPerBroker(s.logdirs)
+	known := make(map[int]bool)
+	for _, bm := range s.brokermetrics {
+		row := BROKERROW{Broker: bm.label(), Version: bm.metrics["kafka_app_info"].v, Parts: perBroker[bm.id],
+			Disk: computeKafkadata(bm.metrics), SizeG: toGiga(bm.metrics["node_filesystem_size_bytes"].v)}
+		cr.MaxDisk = maxFloat(cr.MaxDisk, row.Disk)
+		cr.Brokers = append(cr.Brokers, row)
+		known[bm.id] = true
+	}
+	for i, b := range s.logdirs.Brokers {
+		if !known[b.Broker] {
+			cr.Brokers = append(cr.Brokers, BROKERROW{Broker: fmt.Sprintf("#%d", b.Broker), Parts: parts[i], Disk: -1})
+		}
+	}
+	cr.Imbalance = partitionImbalance(parts)
+	h, err := collectHealth(s.bootstrap, true)
+	if err != nil {
+		cr.Errors = append(cr.Errors, "health : "+err.Error())
+	} else {
+		cr.URP, cr.UMISR, cr.AMISR, cr.UNAV = h.nURP, h.nUMISR, h.nAMISR, h.nUNAV
+	}
+	var out string
+	schedule(s.bootstrap, func() {
+		out, err = group_offsets_cmd(s.bootstrap)
+	})
+	if err != nil {
+		cr.Errors = append(cr.Errors, "groups : "+err.Error())
+	} else {
+		cr.Lags = groupLags(parseGroupOffsets(out))
+		for _, l := range cr.Lags {
+			cr.TotalLag += l.Lag
+		}
+	}
+	flagCluster(&cr)
+	return cr
+}
+
+// Ratio between the most and the least loaded brokers in terms of partitions (1 = balanced)
+func partitionImbalance(parts []int) float64 {
+	if len(parts) == 0 {
+		return 0
+	}
+	mn, mx := parts[0], parts[0]
+	for _, p := range parts {
+		mn = min(mn, p)
+		mx = max(mx, p)
+	}
+	if mn == 0 {
+		if mx == 0 {
+			return 1
+		}
+		return float64(mx)
+	}
+	return float64(mx) / float64(mn)
+}
+
+func maxFloat(a, b float64) float64 {
+	if a < b {
+		return b
+	}
+	return a
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// Compute the status (green, amber, red) of the cluster and the reasons
+func flagCluster(cr *CLUSTERREPORT) {
+	red, amber := make([]string, 0), make([]string, 0)
+	if cr.URP > 0 {
+		red = append(red, fmt.Sprintf("%d under replicated partitions", cr.URP))
+	}
+	if cr.UMISR > 0 {
+		red = append(red, fmt.Sprintf("%d under min isr partitions", cr.UMISR))
+	}
+	if cr.UNAV > 0 {
+		red = append(red, fmt.Sprintf("%d unavailable partitions", cr.UNAV))
+	}
+	if cr.AMISR > 0 {
+		amber = append(amber, fmt.Sprintf("%d at min isr partitions", cr.AMISR))
+	}
+	if cr.MaxDisk > report_diskCrit {
+		red = append(red, fmt.Sprintf("disk usage %.1f%%", cr.MaxDisk))
+	} else if cr.MaxDisk > report_diskWarn {
+		amber = append(amber, fmt.Sprintf("disk usage %.1f%%", cr.MaxDisk))
+	}
+	if cr.Imbalance > 1.2 {
+		amber = append(amber, fmt.Sprintf("partitions imbalance %.2f", cr.Imbalance))
+	}
+	for _, l := range cr.Lags {
+		if l.Lag > report_lagCrit {
+			red = append(red, fmt.Sprintf("group %s lag %d", l.Group, l.Lag))
+		} else if l.Lag > report_lagWarn {
+			amber = append(amber, fmt.Sprintf("group %s lag %d", l.Group, l.Lag))
+		}
+	}
+	if len(cr.Errors) > 0 {
+		amber = append(amber, fmt.Sprintf("%d error(s) while collecting", len(cr.Errors)))
+	}
+	cr.Flags = append(red, amber...)
+	switch {
+	case len(red) > 0:
+		cr.Status = STATUS_RED
+	case len(amber) > 0:
+		cr.Status = STATUS_AMBER
+	default:
+		cr.Status = STATUS_GREEN
+	}
+}
+
+type REPORTDATA struct {
+	Date     string
+	Branches []BRANCHREPORT
+}
+
+var reportFuncs = map[string]interface{}{
+	"topLags": func(lags []GROUPLAG) []GROUPLAG {
+		if len(lags) > 10 {
+			return lags[:10]
+		}
+		return lags
+	},
+	"pct": func(f float64) string {
+		if f < 0 {
+			return "-"
+		}
+		return fmt.Sprintf("%.1f%%", f)
+	},
+	"join":  strings.Join,
+	"upper": strings.ToUpper,
+}
+
+func writeReport(w io.Writer, reports []BRANCHREPORT) error {
+	data := REPORTDATA{Date: time.Now().Format("2006-01-02 15:04"), Branches: reports}
+	if report_format == "md" {
+		t, err := template.New("report").Funcs(reportFuncs).Parse(mdReport)
+		if err != nil {
+			return err
+		}
+		return t.Execute(w, data)
+	}
+	t, err := htmltemplate.New("report").Funcs(reportFuncs).Parse(htmlReport)
+	if err != nil {
+		return err
+	}
+	return t.Execute(w, data)
+}
+
+const mdReport = `# Kafka fleet report ({{.Date}})
+{{range .Branches}}
+## {{.Branch}}
+
+| Cluster | Status | Topics | Partitions | URP | UMISR | AMISR | UNAV | Max disk | Imbalance | Total lag |
+|---|---|---|---|---|---|---|---|---|---|---|
+{{- range .Clusters}}
+| [{{.Cluster}}](#{{.Cluster}}) | {{upper .Status}} | {{.Topics}} | {{.Partitions}} | {{.URP}} | {{.UMISR}} | {{.AMISR}} | {{.UNAV}} | {{pct .MaxDisk}} | {{printf "%.2f" .Imbalance}} | {{.TotalLag}} |
+{{- end}}
+{{range .Clusters}}
+### {{.Cluster}}
+
+**Status : {{upper .Status}}**{{if .Flags}} - {{join .Flags ", "}}{{end}}
+{{if .Errors}}
+Errors :
+{{range .Errors}}
+* {{.}}
+{{- end}}
+{{end}}
+| Broker | Version | Disk | Size | Partitions |
+|---|---|---|---|---|
+{{- range .Brokers}}
+| {{.Broker}} | {{.Version}} | {{pct .Disk}} | {{printf "%.0f" .SizeG}}G | {{.Parts}} |
+{{- end}}
+{{if .Lags}}
+| Group | Lag |
+|---|---|
+{{- range topLags .Lags}}
+| {{.Group}} | {{.Lag}} |
+{{- end}}
+{{end}}
+{{- end}}
+{{- end}}
+`
+
+const htmlReport = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Kafka fleet report {{.Date}}</title>
+<style>
+body { font-family: sans-serif; font-size: 14px; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 1.5em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: right; }
+th { background: #eee; }
+td:first-child, th:first-child { text-align: left; }
+.green { background: #c8e6c9; }
+.amber { background: #ffe0b2; }
+.red { background: #ffcdd2; }
+.flags { margin: 0.5em 0; }
+</style>
+</head>
+<body>
+<h1>Kafka fleet report ({{.Date}})</h1>
+{{range .Branches}}
+<h2>{{.Branch}}</h2>
+<table>
+<tr><th>Cluster</th><th>Status</th><th>Topics</th><th>Partitions</th><th>URP</th><th>UMISR</th><th>AMISR</th><th>UNAV</th><th>Max disk</th><th>Imbalance</th><th>Total lag</th></tr>
+{{- range .Clusters}}
+<tr class="{{.Status}}"><td><a href="#{{.Cluster}}">{{.Cluster}}</a></td><td>{{upper .Status}}</td><td>{{.Topics}}</td><td>{{.Partitions}}</td><td>{{.URP}}</td><td>{{.UMISR}}</td><td>{{.AMISR}}</td><td>{{.UNAV}}</td><td>{{pct .MaxDisk}}</td><td>{{printf "%.2f" .Imbalance}}</td><td>{{.TotalLag}}</td></tr>
+{{- end}}
+</table>
+{{range .Clusters}}
+<h3 id="{{.Cluster}}">{{.Cluster}}</h3>
+<div class="flags {{.Status}}"><b>{{upper .Status}}</b>{{if .Flags}} : {{join .Flags ", "}}{{end}}</div>
+{{if .Errors}}<ul>{{range .Errors}}<li>{{.}}</li>{{end}}</ul>{{end}}
+<table>
+<tr><th>Broker</th><th>Version</th><th>Disk</th><th>Size</th><th>Partitions</th></tr>
+{{- range .Brokers}}
+<tr><td>{{.Broker}}</td><td>{{.Version}}</td><td>{{pct .Disk}}</td><td>{{printf "%.0f" .SizeG}}G</td><td>{{.Parts}}</td></tr>
+{{- end}}
+</table>
+{{if .Lags}}
+<table>
+<tr><th>Group</th><th>Lag</th></tr>
+{{- range topLags .Lags}}
+<tr><td>{{.Group}}</td><td>{{.Lag}}</td></tr>
+{{- end}}
+</table>
+{{end}}
+{{- end}}
+{{- end}}
+</body>
+</html>
+`
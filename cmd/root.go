@@ -32,6 +32,8 @@ var rootCmd = &cobra.Command{
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
+	defer cancelRootCtx()
+	initWatch()
 	if err := rootCmd.Execute(); err != nil {
 		log.Error(err)
 		os.Exit(1)
@@ -106,9 +108,10 @@ func initConfig() {
 	viper.AutomaticEnv() // read in environment variables that match
 
 	// If a config file is found, read it in.
-	if err := viper.ReadInConfig(); err == nil {
+	if err := viper.ReadInConfig(); err == nil && session == nil {
 		fmt.Println("Using config file:", viper.ConfigFileUsed())
 	}
 
 	logSetLevel()
+	initContext()
 }
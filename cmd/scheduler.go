@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"sync"
+)
+
+var parallelism, clusterParallelism int
+
+func init() {
+	rootCmd.PersistentFlags().IntVarP(&parallelism, "parallelism", "", 16, "Maximum number of commands (kafka scripts, requests) running at the same time")
+	rootCmd.PersistentFlags().IntVarP(&clusterParallelism, "cluster-parallelism", "", 4, "Maximum number of commands running at the same time on one cluster")
+}
+
+// Shared scheduler : limits the number of running tasks, globally and per cluster,
+// and dispatches the queued tasks in a round robin way over the clusters
+type SCHEDULER struct {
+	mu      sync.Mutex
+	queues  map[string][]func() // queued tasks per cluster
+	order   []string            // clusters in order of arrival, for the round robin
+	next    int
+	running int
+	perKey  map[string]int // running tasks per cluster
+}
+
+var sched = &SCHEDULER{queues: make(map[string][]func()), perKey: make(map[string]int)}
+
+// Queue a task for the given cluster (or any key identifying the target, like the bootstrap servers)
+func (s *SCHEDULER) submit(key string, task func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exist := s.queues[key]; !exist {
+		s.order = append(s.order, key)
+	}
+	s.queues[key] = append(s.queues[key], task)
+	s.dispatch()
+}
+
+// Start as many queued tasks as allowed; the lock must be held
+func (s *SCHEDULER) dispatch() {
+	for s.running < max(parallelism, 1) {
+		key, ok := s.pick()
+		if !ok {
+			return
+		}
+		task := s.queues[key][0]
+		s.queues[key] = s.queues[key][1:]
+		s.running++
+		s.perKey[key]++
+		go func() {
+			task()
+			s.mu.Lock()
+			s.running--
+			s.perKey[key]--
+			s.dispatch()
+			s.mu.Unlock()
+		}()
+	}
+}
+
+// Return the next cluster having a queued task and less running tasks than allowed
+func (s *SCHEDULER) pick() (string, bool) {
+	n := len(s.order)
+	for i := 0; i < n; i++ {
+		key := s.order[(s.next+i)%n]
+		if len(s.queues[key]) > 0 && s.perKey[key] < max(clusterParallelism, 1) {
+			s.next = (s.next + i + 1) % n
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// A set of tasks run by the scheduler, which can be waited for.
+// Wait must not be called from inside a task, otherwise the scheduler may be exhausted.
+type TASKS struct {
+	wg    sync.WaitGroup
+	mu    sync.Mutex
+	abort *SHELLABORT // logFatal of a task in the shell, raised again by Wait on the goroutine of the command
+}
+
+func (t *TASKS) Go(key string, task func()) {
+	t.wg.Add(1)
+	sched.submit(key, func() {
+		defer t.wg.Done()
+		defer t.recoverAbort()
+		task()
+	})
+}
+
+func (t *TASKS) recoverAbort() {
+	if r := recover(); r != nil {
+		abort, ok := r.(SHELLABORT)
+		if !ok {
+			panic(r)
+		}
+		t.mu.Lock()
+		if t.abort == nil {
+			t.abort = &abort
+		}
+		t.mu.Unlock()
+	}
+}
+
+func (t *TASKS) Wait() {
+	t.wg.Wait()
+	if t.abort != nil {
+		panic(*t.abort)
+	}
+}
+
+// Run one task with the scheduler and wait for it : for the commands of a function which also schedules its own tasks,
+// and so is run on a plain goroutine
+func schedule(key string, task func()) {
+	var tasks TASKS
+	tasks.Go(key, task)
+	tasks.Wait()
+}
@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Use a fresh scheduler with the given limits for the test; at the end, wait until its goroutines are done
+// since they read the limits
+func testScheduler(t *testing.T, global, perCluster int) {
+	t.Helper()
+	saved, savedP, savedCP := sched, parallelism, clusterParallelism
+	parallelism, clusterParallelism = global, perCluster
+	sched = &SCHEDULER{queues: make(map[string][]func()), perKey: make(map[string]int)}
+	t.Cleanup(func() {
+		for {
+			sched.mu.Lock()
+			running := sched.running
+			sched.mu.Unlock()
+			if running == 0 {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		sched, parallelism, clusterParallelism = saved, savedP, savedCP
+	})
+}
+
+func TestSchedulerLimits(t *testing.T) {
+	testScheduler(t, 3, 2)
+	fakeRunner(t, map[string]string{"kafka-topics.sh --list": "topic1"})
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	perKey, maxPerKey := make(map[string]int), 0
+	done := 0
+	var tasks TASKS
+	for i := 0; i < 30; i++ {
+		key := fmt.Sprintf("cluster%d", i%3)
+		tasks.Go(key, func() {
+			mu.Lock()
+			running++
+			perKey[key]++
+			maxRunning = max(maxRunning, running)
+			maxPerKey = max(maxPerKey, perKey[key])
+			mu.Unlock()
+			time.Sleep(time.Millisecond)
+			out, err := runCommand("kafka-topics.sh", "--list")
+			mu.Lock()
+			if err == nil && out == "topic1" {
+				done++
+			}
+			running--
+			perKey[key]--
+			mu.Unlock()
+		})
+	}
+	tasks.Wait()
+	if done != 30 {
+		t.Errorf("%d tasks done, want 30", done)
+	}
+	if maxRunning > 3 {
+		t.Errorf("%d tasks running at the same time, the limit is 3", maxRunning)
+	}
+	if maxPerKey > 2 {
+		t.Errorf("%d tasks running at the same time on one cluster, the limit is 2", maxPerKey)
+	}
+}
+
+func TestSchedulerRoundRobin(t *testing.T) {
+	testScheduler(t, 1, 1)
+	var mu sync.Mutex
+	order := make([]string, 0)
+	gate := make(chan struct{})
+	var tasks TASKS
+	tasks.Go("gate", func() { <-gate }) // holds the only slot while the other tasks are queued
+	for _, name := range []string{"a1", "a2", "a3", "b1", "b2"} {
+		name := name
+		tasks.Go(name[:1], func() {
+			mu.Lock()
+			order = append(order, name)
+			mu.Unlock()
+		})
+	}
+	close(gate)
+	tasks.Wait()
+	if got := strings.Join(order, ","); got != "a1,b1,a2,b2,a3" {
+		t.Errorf("order = %s, want a1,b1,a2,b2,a3", got)
+	}
+}
+
+func TestTasksRaiseShellAbortOnWait(t *testing.T) {
+	testScheduler(t, 2, 1)
+	saved := session
+	session = newSession()
+	defer func() { session = saved }()
+	var tasks TASKS
+	tasks.Go("bkt28", func() { logFatal(errors.New("no connection to bkt28")) })
+	tasks.Go("bkt29", func() {})
+	defer func() {
+		abort, ok := recover().(SHELLABORT)
+		if !ok || abort.err.Error() != "no connection to bkt28" {
+			t.Errorf("Wait raised %v, want the SHELLABORT of the task", abort)
+		}
+	}()
+	tasks.Wait()
+}
+
+func TestClusterFanOutIsScheduled(t *testing.T) {
+	testScheduler(t, 2, 1)
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	saved := runCommand
+	runCommand = func(name string, args ...string) (string, error) {
+		mu.Lock()
+		running++
+		maxRunning = max(maxRunning, running)
+		mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return "orders", nil
+	}
+	defer func() { runCommand = saved }()
+	servers := make([]SERVER, 6)
+	for i := range servers {
+		servers[i] = SERVER{cluster: fmt.Sprintf("bkt%d", i), bootstrap: fmt.Sprintf("bk%d.example.net:9092", i)}
+	}
+	getTopicsFromClusters(servers)
+	for _, s := range servers {
+		if s.topics != "orders" {
+			t.Errorf("%s topics = %q", s.cluster, s.topics)
+		}
+	}
+	if maxRunning > 2 {
+		t.Errorf("%d commands running at the same time, the limit is 2", maxRunning)
+	}
+}
@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"errors"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var includes, excludes string
+var useRegex, hideInternal bool
+
+func init() {
+	rootCmd.PersistentFlags().StringVarP(&includes, "include", "", "", "Keep only the topics/groups matching one of these patterns (glob, or regex with --regex), comma separated (e.g. orders.*,payments.*)")
+	rootCmd.PersistentFlags().StringVarP(&excludes, "exclude", "", "", "Remove the topics/groups matching one of these patterns (glob, or regex with --regex), comma separated")
+	rootCmd.PersistentFlags().BoolVarP(&useRegex, "regex", "", false, "The --include and --exclude patterns are regular expressions instead of globs")
+	rootCmd.PersistentFlags().BoolVarP(&hideInternal, "hide-internal", "", false, "Hide the internal topics (__consumer_offsets, __transaction_state, MM2 heartbeats/checkpoints, connect configs/offsets/status, ...)")
+	rootCmd.PersistentPreRun = func(cmd *cobra.Command, args []string) {
+		logFatal(compileSelection())
+	}
+}
+
+// A pattern is either a glob or a regular expression
+type PATTERN struct {
+	glob string
+	re   *regexp.Regexp
+}
+
+func (p PATTERN) match(name string) bool {
+	if p.re != nil {
+		return p.re.MatchString(name)
+	}
+	ok, _ := path.Match(p.glob, name)
+	return ok
+}
+
+var includePatterns, excludePatterns []PATTERN
+
+// Compile the --include and --exclude patterns of the command, before it runs (again for each command of the shell)
+func compileSelection() error {
+	var err error
+	if includePatterns, err = compilePatterns(includes); err != nil {
+		return err
+	}
+	excludePatterns, err = compilePatterns(excludes)
+	return err
+}
+
+func compilePatterns(s string) ([]PATTERN, error) {
+	patterns := make([]PATTERN, 0)
+	for _, p := range strings.Split(s, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if useRegex {
+			re, err := regexp.Compile("^(" + p + ")$")
+			if err != nil {
+				return nil, errors.New("Bad pattern " + p + " : " + err.Error())
+			}
+			patterns = append(patterns, PATTERN{re: re})
+		} else {
+			if _, err := path.Match(p, ""); err != nil {
+				return nil, errors.New("Bad pattern " + p + " : " + err.Error())
+			}
+			patterns = append(patterns, PATTERN{glob: p})
+		}
+	}
+	return patterns, nil
+}
+
+// Return true if the name matches the --include and --exclude patterns
+func selected(name string) bool {
+	if len(includePatterns) > 0 {
+		found := false
+		for _, p := range includePatterns {
+			if p.match(name) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	for _, p := range excludePatterns {
+		if p.match(name) {
+			return false
+		}
+	}
+	return true
+}
+
+var reInternal = regexp.MustCompile(`^(__.*|heartbeats|.*\.heartbeats|.*\.checkpoints\.internal|mm2-.*\.internal|.*-mm2-.*\.internal|(.*-)?connect-(configs|offsets|status))$`)
+
+// Return true for kafka, MirrorMaker2 and kafka connect internal topics
+func isInternalTopic(name string) bool {
+	return reInternal.MatchString(name)
+}
+
+func selectedTopic(name string) bool {
+	return selected(name) && !(hideInternal && isInternalTopic(name))
+}
+
+// Filter a list of topics (one topic per line, as returned by kafka-topics.sh --list)
+func selectTopicList(list string) string {
+	res := make([]string, 0)
+	for _, t := range strings.Split(strings.TrimSpace(list), "\n") {
+		if t = strings.TrimSpace(t); t != "" && selectedTopic(t) {
+			res = append(res, t)
+		}
+	}
+	return strings.Join(res, "\n")
+}
+
+func selectTopicDetails(at []topicDetails) []topicDetails {
+	res := make([]topicDetails, 0, len(at))
+	for _, t := range at {
+		if selectedTopic(t.name) {
+			res = append(res, t)
+		}
+	}
+	return res
+}
+
+func selectGroups(groups []GROUP) []GROUP {
+	res := make([]GROUP, 0, len(groups))
+	for _, g := range groups {
+		if selected(g.name) {
+			res = append(res, g)
+		}
+	}
+	return res
+}
+
+// Filter the acls on the resource name (topic, group, ...)
+func selectAcls(acls []ACL) []ACL {
+	res := make([]ACL, 0, len(acls))
+	for _, a := range acls {
+		if a.rtype == "TOPIC" && !selectedTopic(a.topic) || a.rtype != "TOPIC" && !selected(a.topic) {
+			continue
+		}
+		res = append(res, a)
+	}
+	return res
+}
@@ -0,0 +1,42 @@
+package cmd
+
+import "testing"
+
+func TestCompileSelectionPerCommand(t *testing.T) {
+	defer func() {
+		includes, useRegex = "", false
+		compileSelection()
+	}()
+	includes = "orders*"
+	if err := compileSelection(); err != nil {
+		t.Fatal(err)
+	}
+	if !selected("orders-eu") || selected("payments") {
+		t.Error("orders* must select orders-eu only")
+	}
+	includes = "payments" // the next command of the shell
+	if err := compileSelection(); err != nil {
+		t.Fatal(err)
+	}
+	if selected("orders-eu") || !selected("payments") {
+		t.Error("the patterns of the previous command are still used")
+	}
+	includes, useRegex = "orders[", true
+	if err := compileSelection(); err == nil {
+		t.Error("no error for a bad regex")
+	}
+}
+
+func TestIsInternalTopic(t *testing.T) {
+	for _, name := range []string{"__consumer_offsets", "heartbeats", "bkp28.heartbeats", "bkp28.checkpoints.internal",
+		"mm2-offset-syncs.bkp28.internal", "mm2-configs.bkp28.internal", "connect-offsets", "bkt28-connect-status"} {
+		if !isInternalTopic(name) {
+			t.Errorf("%s is internal", name)
+		}
+	}
+	for _, name := range []string{"orders", "connect-orders", "checkpoints"} {
+		if isInternalTopic(name) {
+			t.Errorf("%s is not internal", name)
+		}
+	}
+}
@@ -0,0 +1,422 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-git/go-billy/v5"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"golang.org/x/term"
+)
+
+// Represent the shell command
+var shellCmd = &cobra.Command{
+	Use:   "shell",
+	Short: "Interactive shell keeping the servers, git inventories and topic/group lists between commands",
+	Long: `Run kstat commands in a shell (e.g. "topic -s", "health") : the git repositories, the servers, the credentials,
+  the kubernetes client and the topic and group lists are kept between the commands.
+  Tab completes the commands, and the cluster, branch, topic and group names.
+  "use cluster bkt28", "use branch ERDING_TL1" or "use ns kafka-xxx" set the default --cluster, --git-branch or --ns,
+  "use none" clears them, "refresh" empties the caches and "exit" quits.
+	e.g. go run kstat.go shell `,
+
+	Run: func(cmd *cobra.Command, args []string) {
+		if !term.IsTerminal(int(os.Stdin.Fd())) {
+			logFatal(errors.New("shell needs a terminal"))
+		}
+		session = newSession()
+		runShell()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(shellCmd)
+}
+
+// State kept between the commands of the shell
+type SESSION struct {
+	mu                  sync.Mutex
+	fs                  map[string]billy.Filesystem // git repositories per branch
+	servers             map[string][]SERVER         // resolved servers per selection (branch, inventory, clusters, broker)
+	lists               map[string]string           // topic and group lists per bootstrap servers
+	cluster, branch, ns string                      // defaults set by "use"
+	login, passwd       string
+}
+
+// Not nil only inside the shell
+var session *SESSION
+
+func newSession() *SESSION {
+	return &SESSION{fs: make(map[string]billy.Filesystem), servers: make(map[string][]SERVER), lists: make(map[string]string)}
+}
+
+func (s *SESSION) getFs(branch string) (billy.Filesystem, bool) {
+	if s == nil {
+		return nil, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fs, ok := s.fs[branch]
+	return fs, ok
+}
+
+func (s *SESSION) putFs(branch string, fs billy.Filesystem) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fs[branch] = fs
+}
+
+// Key of the servers resolved from the current flags
+func serversKey() string {
+	return strings.Join([]string{gitBranch, invFile, clustername, brokername}, "|")
+}
+
+// Return a copy of the cached servers, as the commands fill the topics, groups and metrics of their servers
+func (s *SESSION) getServers(key string) ([]SERVER, bool) {
+	if s == nil {
+		return nil, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	servers, ok := s.servers[key]
+	return append([]SERVER(nil), servers...), ok
+}
+
+func (s *SESSION) putServers(key string, servers []SERVER) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.servers[key] = append([]SERVER(nil), servers...)
+}
+
+// Return the cached list (topics, groups) of the bootstrap servers, or run the command and cache its result.
+// With --watch or --until, the list is run again at each round.
+func (s *SESSION) cachedList(kind, bootstrap string, run func() (string, error)) (string, error) {
+	if s == nil || watch > 0 || until != "" {
+		return run()
+	}
+	key := kind + " " + bootstrap
+	s.mu.Lock()
+	list, ok := s.lists[key]
+	s.mu.Unlock()
+	if ok {
+		return list, nil
+	}
+	list, err := run()
+	if err != nil {
+		return list, err
+	}
+	s.mu.Lock()
+	s.lists[key] = list
+	s.mu.Unlock()
+	return list, nil
+}
+
+// All the names of the given kind already listed in the session
+func (s *SESSION) listed(kind string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0)
+	for k, list := range s.lists {
+		if strings.HasPrefix(k, kind+" ") {
+			names = append(names, strings.Fields(list)...)
+		}
+	}
+	return names
+}
+
+// The cluster names of the resolved servers and of the git inventories
+func (s *SESSION) clusters() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0)
+	for _, servers := range s.servers {
+		for _, srv := range servers {
+			names = append(names, srv.cluster)
+		}
+	}
+	for _, fs := range s.fs {
+		inv, err := buildClusterInventory(fs)
+		if err == nil {
+			names = append(names, inv...)
+		}
+	}
+	return names
+}
+
+func (s *SESSION) clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fs = make(map[string]billy.Filesystem)
+	s.servers = make(map[string][]SERVER)
+	s.lists = make(map[string]string)
+	clientset, dynset = nil, nil
+}
+
+// Raised by logFatal inside the shell, so that a failing command does not end the shell
+type SHELLABORT struct {
+	err error
+}
+
+func (s *SESSION) prompt() string {
+	ctx := make([]string, 0)
+	for _, c := range []string{s.branch, s.cluster, s.ns} {
+		if c != "" {
+			ctx = append(ctx, c)
+		}
+	}
+	if len(ctx) == 0 {
+		return "kstat> "
+	}
+	return "kstat[" + strings.Join(ctx, " ") + "]> "
+}
+
+func runShell() {
+	t := term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{os.Stdin, os.Stdout}, session.prompt())
+	t.AutoCompleteCallback = complete
+	for {
+		t.SetPrompt(session.prompt())
+		oldState, err := term.MakeRaw(int(os.Stdin.Fd()))
+		if logErr(err) {
+			return
+		}
+		line, err := t.ReadLine()
+		term.Restore(int(os.Stdin.Fd()), oldState)
+		if err != nil { // Ctrl-D
+			return
+		}
+		args, err := splitArgs(line)
+		if logErr(err) || len(args) == 0 {
+			continue
+		}
+		switch args[0] {
+		case "exit", "quit":
+			return
+		case "refresh":
+			session.clear()
+		case "use":
+			logErr(session.use(args[1:]))
+		case "shell":
+			fmt.Println("Already in the shell")
+		default:
+			runInShell(args)
+		}
+	}
+}
+
+// Set the defaults of the next commands
+func (s *SESSION) use(args []string) error {
+	if len(args) == 0 {
+		fmt.Printf("cluster=%s branch=%s ns=%s\n", s.cluster, s.branch, s.ns)
+		return nil
+	}
+	if args[0] == "none" {
+		s.cluster, s.branch, s.ns = "", "", ""
+		return nil
+	}
+	if len(args) != 2 {
+		return errors.New("usage : use cluster|branch|ns NAME, or use none")
+	}
+	switch args[0] {
+	case "cluster":
+		s.cluster = args[1]
+	case "branch":
+		s.branch = args[1]
+	case "ns":
+		s.ns = args[1]
+	default:
+		return errors.New("usage : use cluster|branch|ns NAME, or use none")
+	}
+	return nil
+}
+
+// Run one kstat command with the session defaults; the flags are reset before, and logFatal does not exit
+func runInShell(args []string) {
+	resetFlags(rootCmd)
+	login, passwd = session.login, session.passwd
+	if session.cluster != "" && !hasFlag(args, "-c", "--cluster", "-b", "--broker") {
+		args = append(args, "--cluster", session.cluster)
+	}
+	if session.branch != "" && !hasFlag(args, "--git-branch", "--inv") {
+		args = append(args, "--git-branch", session.branch)
+	}
+	if session.ns != "" && !hasFlag(args, "--ns") {
+		args = append(args, "--ns", session.ns)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(SHELLABORT); !ok {
+				panic(r)
+			}
+		}
+		cancelRootCtx()
+		session.login, session.passwd = login, passwd
+	}()
+	rootCmd.SetArgs(args)
+	if err := rootCmd.Execute(); err != nil {
+		log.Error(err)
+	}
+}
+
+func hasFlag(args []string, names ...string) bool {
+	for _, a := range args {
+		for _, n := range names {
+			if a == n || strings.HasPrefix(a, n+"=") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Set back all the flags of the command and its sub commands to their default value
+func resetFlags(c *cobra.Command) {
+	reset := func(f *pflag.Flag) {
+		if !f.Changed {
+			return
+		}
+		if sv, ok := f.Value.(pflag.SliceValue); ok {
+			sv.Replace([]string{})
+		} else {
+			f.Value.Set(f.DefValue)
+		}
+		f.Changed = false
+	}
+	c.Flags().VisitAll(reset)
+	c.PersistentFlags().VisitAll(reset)
+	for _, sub := range c.Commands() {
+		resetFlags(sub)
+	}
+}
+
+// Split the line in arguments, with single or double quotes
+func splitArgs(line string) ([]string, error) {
+	args := make([]string, 0)
+	var cur strings.Builder
+	var quote rune
+	inArg := false
+	for _, r := range line {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			cur.WriteRune(r)
+		case r == '\'' || r == '"':
+			quote, inArg = r, true
+		case r == ' ' || r == '\t':
+			if inArg {
+				args = append(args, cur.String())
+				cur.Reset()
+				inArg = false
+			}
+		default:
+			cur.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, errors.New("Unterminated quote")
+	}
+	if inArg {
+		args = append(args, cur.String())
+	}
+	return args, nil
+}
+
+// Complete the word before the cursor on tab
+func complete(line string, pos int, key rune) (string, int, bool) {
+	if key != '\t' {
+		return "", 0, false
+	}
+	before := line[:pos]
+	words := strings.Fields(before)
+	if strings.HasSuffix(before, " ") || len(words) == 0 {
+		words = append(words, "")
+	}
+	word := words[len(words)-1]
+	prefix := word[strings.LastIndex(word, ",")+1:] // comma separated lists : complete the last name
+	matches := make([]string, 0)
+	for _, c := range candidates(words) {
+		if strings.HasPrefix(c, prefix) && !inArray(matches, c) {
+			matches = append(matches, c)
+		}
+	}
+	if len(matches) == 0 {
+		return "", 0, false
+	}
+	sort.Strings(matches)
+	completion := commonPrefix(matches)
+	if len(matches) == 1 {
+		completion += " "
+	}
+	newLine := before[:len(before)-len(prefix)] + completion + line[pos:]
+	return newLine, pos - len(prefix) + len(completion), true
+}
+
+// The names which may replace the last word
+func candidates(words []string) []string {
+	if len(words) == 1 {
+		names := []string{"use", "refresh", "exit"}
+		for _, c := range rootCmd.Commands() {
+			names = append(names, c.Name())
+		}
+		return names
+	}
+	prev := words[len(words)-2]
+	if words[0] == "use" {
+		switch {
+		case len(words) == 2:
+			return []string{"cluster", "branch", "ns", "none"}
+		case prev == "cluster":
+			return session.clusters()
+		case prev == "branch":
+			return branchs[:]
+		}
+		return nil
+	}
+	switch prev {
+	case "-c", "--cluster":
+		return session.clusters()
+	case "--git-branch":
+		return branchs[:]
+	case "-t", "--topic":
+		return session.listed("topics")
+	case "-g", "--group":
+		return session.listed("groups")
+	}
+	if len(words) == 2 {
+		if c, _, err := rootCmd.Find(words[:1]); err == nil {
+			names := make([]string, 0)
+			for _, sub := range c.Commands() {
+				names = append(names, sub.Name())
+			}
+			return names
+		}
+	}
+	return nil
+}
+
+func commonPrefix(a []string) string {
+	p := a[0]
+	for _, s := range a[1:] {
+		for !strings.HasPrefix(s, p) {
+			p = p[:len(p)-1]
+		}
+	}
+	return p
+}
@@ -0,0 +1,428 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// Represent the top command
+var topCmd = &cobra.Command{
+	Use:   "top",
+	Short: "[ERDING] Interactive dashboard of the health, brokers, topics and lagging groups of the clusters",
+	Long: `Display a dashboard refreshed periodically with the health counts (URP, UMISR, AMISR, UNAV), the kafkadata disk usage,
+  the version and the partitions of each broker, and the most lagging groups of the selected clusters.
+  Use the arrows (or j/k) to select a line, enter (or l) to drill down from cluster to broker, topic and group,
+  backspace (or h) to go back, r to refresh now and q to quit.
+	e.g. go run kstat.go --git-branch ERDING_PRD top --refresh 30s `,
+
+	Run: func(cmd *cobra.Command, args []string) {
+		if !term.IsTerminal(int(os.Stdin.Fd())) {
+			logFatal(errors.New("top needs a terminal"))
+		}
+		servers, err := initServers()
+		logFatal(err)
+		logFatal(runTop(servers))
+	},
+}
+
+var top_refresh time.Duration
+
+func init() {
+	rootCmd.AddCommand(topCmd)
+	// Cobra supports local flags which will only run when this command is called directly, e.g.:
+	topCmd.Flags().DurationVarP(&top_refresh, "refresh", "", 10*time.Second, "Refresh period")
+}
+
+// A broker as displayed by top
+type TOPBROKER struct {
+	id                int
+	host, version     string
+	disk              float64
+	replicas, leaders int
+}
+
+// Everything top displays about one cluster
+type TOPCLUSTER struct {
+	cluster string
+	health  HEALTH
+	brokers []TOPBROKER
+	topics  []topicDetails
+	offsets []OFFSET
+	lags    []GROUPLAG
+	errors  []string
+}
+
+// Collect the snapshot of all clusters, with the same collectors as health, info, topic and group
+func collectTop(servers []SERVER) []TOPCLUSTER {
+	nodeMetrics, kafkaMetrics := initNodeMetrics(), initKafkaMetrics()
+	res := make([]TOPCLUSTER, len(servers))
+	var wg sync.WaitGroup
+	for i := range servers {
+		wg.Add(1)
+		go func(i int) { // the commands are run by the scheduler
+			res[i] = collectTopCluster(servers[i], nodeMetrics, kafkaMetrics)
+			wg.Done()
+		}(i)
+	}
+	wg.Wait()
+	return res
+}
+
+func collectTopCluster(s SERVER, nodeMetrics, kafkaMetrics []string) TOPCLUSTER {
+	tc := TOPCLUSTER{cluster: s.cluster}
+	addErr := func(what string, err error) bool {
+		if err != nil {
+			tc.errors = append(tc.errors, what+" : "+err.Error())
+		}
+		return err != nil
+	}
+	h, err := collectHealth(s.bootstrap, true)
+	if !addErr("health", err) {
+		tc.health = h
+	}
+	var out string
+	schedule(s.bootstrap, func() {
+		out, err = topics_cmdList(s.bootstrap)
+		if err == nil {
+			tc.topics, err = getDetails(s.bootstrap, strings.Split(selectTopicList(out), "\n"))
+		}
+	})
+	addErr("topics", err)
+	balance := make(map[int]BROKERBALANCE)
+	for _, b := range leaderBalance(tc.topics) {
+		balance[b.broker] = b
+	}
+	schedule(s.bootstrap, func() {
+		out, err = brokers_cmdApiVersions(s.bootstrap)
+	})
+	if !addErr("brokers", err) {
+		infos := parseApiVersions(out)
+		tc.brokers = make([]TOPBROKER, len(infos))
+		var tasks TASKS
+		for i, b := range infos {
+			i, b := i, b
+			tasks.Go(s.bootstrap, func() {
+				bm := brokerMetrics(b.host, nodeMetrics, kafkaMetrics)
+				tc.brokers[i] = TOPBROKER{id: b.id, host: b.host, version: bm.metrics["kafka_app_info"].v,
+					disk: computeKafkadata(bm.metrics), replicas: balance[b.id].replicas, leaders: balance[b.id].leaders}
+			})
+		}
+		tasks.Wait()
+	}
+	schedule(s.bootstrap, func() {
+		out, err = group_offsets_cmd(s.bootstrap)
+	})
+	if !addErr("groups", err) {
+		tc.offsets = parseGroupOffsets(out)
+		tc.lags = groupLags(tc.offsets)
+	}
+	return tc
+}
+
+func (tc TOPCLUSTER) totalLag() int64 {
+	var total int64
+	for _, l := range tc.lags {
+		total += l.Lag
+	}
+	return total
+}
+
+func (tc TOPCLUSTER) maxDisk() float64 {
+	m := 0.
+	for _, b := range tc.brokers {
+		m = maxFloat(m, b.disk)
+	}
+	return m
+}
+
+// Levels of the drill-down
+const (
+	TOP_CLUSTERS = iota
+	TOP_BROKERS
+	TOP_TOPICS
+	TOP_GROUPS
+	TOP_OFFSETS
+)
+
+// Current position in the drill-down
+type TOPSTATE struct {
+	level    int
+	selected [TOP_OFFSETS + 1]int
+	cluster  string
+	broker   int
+	topic    string
+	group    string
+}
+
+// Return the title, the header and the lines of the current level; the keys identify the lines for the drill-down
+func (st *TOPSTATE) view(snapshot []TOPCLUSTER) (string, string, []string, []string) {
+	lines, keys := make([]string, 0), make([]string, 0)
+	var tc TOPCLUSTER
+	for _, c := range snapshot {
+		if c.cluster == st.cluster {
+			tc = c
+		}
+	}
+	switch st.level {
+	case TOP_CLUSTERS:
+		for _, c := range snapshot {
+			top := "-"
+			if len(c.lags) > 0 {
+				top = fmt.Sprintf("%s(%d)", c.lags[0].Group, c.lags[0].Lag)
+			}
+			status := ""
+			if len(c.errors) > 0 {
+				status = fmt.Sprintf("%d error(s)", len(c.errors))
+			}
+			lines = append(lines, fmt.Sprintf("%-10s %4d %5d %5d %4d %7d %6.2f%% %6d %12d  %-40s %s", c.cluster, c.health.nURP, c.health.nUMISR,
+				c.health.nAMISR, c.health.nUNAV, len(c.brokers), c.maxDisk(), len(c.topics), c.totalLag(), top, status))
+			keys = append(keys, c.cluster)
+		}
+		return "clusters", fmt.Sprintf("%-10s %4s %5s %5s %4s %7s %7s %6s %12s  %-40s %s", "CLUSTER", "URP", "UMISR", "AMISR", "UNAV", "BROKERS", "DISK", "TOPICS", "LAG", "TOP GROUP", "ERRORS"), lines, keys
+	case TOP_BROKERS:
+		for _, b := range tc.brokers {
+			lines = append(lines, fmt.Sprintf("%4d %-40s %-8s %6.2f%% %8d %8d", b.id, b.host, b.version, b.disk, b.replicas, b.leaders))
+			keys = append(keys, fmt.Sprint(b.id))
+		}
+		for i, l := range tc.lags {
+			if i == 5 || l.Lag == 0 {
+				break
+			}
+			lines = append(lines, fmt.Sprintf("     lagging group %-40s %12d", l.Group, l.Lag))
+			keys = append(keys, "")
+		}
+		for _, e := range tc.errors {
+			lines = append(lines, "     ERROR "+e)
+			keys = append(keys, "")
+		}
+		return tc.cluster + " > brokers", fmt.Sprintf("%4s %-40s %-8s %7s %8s %8s", "ID", "HOST", "VERSION", "DISK", "REPLICAS", "LEADERS"), lines, keys
+	case TOP_TOPICS:
+		lag := make(map[string]int64)
+		for _, o := range tc.offsets {
+			if o.lag > 0 {
+				lag[o.topic] += o.lag
+			}
+		}
+		for _, t := range tc.topics {
+			replicas, leaders, urp := 0, 0, 0
+			for _, p := range t.parts {
+				if inArray(p.replicas, st.broker) {
+					replicas++
+					if len(p.isr) < len(p.replicas) {
+						urp++
+					}
+				}
+				if p.leader == st.broker {
+					leaders++
+				}
+			}
+			if replicas == 0 {
+				continue
+			}
+			lines = append(lines, fmt.Sprintf("%-60s %8d %8d %4d %12d", t.name, replicas, leaders, urp, lag[t.name]))
+			keys = append(keys, t.name)
+		}
+		return fmt.Sprintf("%s > broker %d > topics", tc.cluster, st.broker), fmt.Sprintf("%-60s %8s %8s %4s %12s", "TOPIC", "REPLICAS", "LEADERS", "URP", "LAG"), lines, keys
+	case TOP_GROUPS:
+		lag, parts := make(map[string]int64), make(map[string]int)
+		for _, o := range tc.offsets {
+			if o.topic == st.topic {
+				parts[o.group]++
+				if o.lag > 0 {
+					lag[o.group] += o.lag
+				}
+			}
+		}
+		groups := make([]string, 0, len(parts))
+		for g := range parts {
+			groups = append(groups, g)
+		}
+		sort.Slice(groups, func(i, j int) bool {
+			if lag[groups[i]] == lag[groups[j]] {
+				return groups[i] < groups[j]
+			}
+			return lag[groups[i]] > lag[groups[j]]
+		})
+		for _, g := range groups {
+			lines = append(lines, fmt.Sprintf("%-60s %10d %12d", g, parts[g], lag[g]))
+			keys = append(keys, g)
+		}
+		return fmt.Sprintf("%s > broker %d > %s > groups", tc.cluster, st.broker, st.topic), fmt.Sprintf("%-60s %10s %12s", "GROUP", "PARTITIONS", "LAG"), lines, keys
+	default:
+		for _, o := range tc.offsets {
+			if o.topic == st.topic && o.group == st.group {
+				lines = append(lines, fmt.Sprintf("%9d %14d %14d %12d  %s %s", o.partition, o.current, o.logEnd, o.lag, o.consumerId, o.host))
+				keys = append(keys, "")
+			}
+		}
+		return fmt.Sprintf("%s > broker %d > %s > %s", tc.cluster, st.broker, st.topic, st.group), fmt.Sprintf("%9s %14s %14s %12s  %s", "PARTITION", "CURRENT", "LOG-END", "LAG", "CONSUMER"), lines, keys
+	}
+}
+
+// Go down to the selected line
+func (st *TOPSTATE) enter(keys []string) {
+	if st.level == TOP_OFFSETS || len(keys) == 0 {
+		return
+	}
+	key := keys[st.selected[st.level]]
+	if key == "" {
+		return
+	}
+	switch st.level {
+	case TOP_CLUSTERS:
+		st.cluster = key
+	case TOP_BROKERS:
+		fmt.Sscan(key, &st.broker)
+	case TOP_TOPICS:
+		st.topic = key
+	case TOP_GROUPS:
+		st.group = key
+	}
+	st.level++
+	st.selected[st.level] = 0
+}
+
+func (st *TOPSTATE) back() {
+	if st.level > TOP_CLUSTERS {
+		st.level--
+	}
+}
+
+func (st *TOPSTATE) move(delta, n int) {
+	st.selected[st.level] = min(max(st.selected[st.level]+delta, 0), max(n-1, 0))
+}
+
+// Draw the current level; the lines are scrolled to keep the selected one visible
+func drawTop(w io.Writer, st *TOPSTATE, snapshot []TOPCLUSTER, updated time.Time, collecting bool) []string {
+	title, header, lines, keys := st.view(snapshot)
+	st.move(0, len(lines))
+	width, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		width, height = 200, 40
+	}
+	status := "refreshed " + updated.Format("15:04:05")
+	if updated.IsZero() {
+		status = "collecting..."
+	} else if collecting {
+		status += ", refreshing..."
+	}
+	out := []string{
+		fmt.Sprintf("kstat top : %s (%s)", title, status),
+		"arrows/jk: select, enter/l: drill down, backspace/h: back, r: refresh, q: quit",
+		"",
+		"\x1b[1m" + cut(header, width) + "\x1b[0m",
+	}
+	visible := max(height-len(out)-1, 1)
+	first := 0
+	if sel := st.selected[st.level]; sel >= visible {
+		first = sel - visible + 1
+	}
+	for i := first; i < len(lines) && i < first+visible; i++ {
+		line := cut(lines[i], width)
+		if i == st.selected[st.level] && st.level < TOP_OFFSETS {
+			line = "\x1b[7m" + line + "\x1b[0m"
+		}
+		out = append(out, line)
+	}
+	fmt.Fprint(w, "\x1b[H\x1b[2J"+strings.Join(out, "\r\n"))
+	return keys
+}
+
+func cut(s string, width int) string {
+	if len(s) > width {
+		return s[:width]
+	}
+	return s
+}
+
+// Run the dashboard until q, Ctrl-C or the --deadline
+func runTop(servers []SERVER) error {
+	oldState, err := term.MakeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		return err
+	}
+	defer term.Restore(int(os.Stdin.Fd()), oldState)
+	log.SetOutput(io.Discard) // the errors are displayed in the dashboard
+	defer log.SetOutput(os.Stderr)
+	fmt.Print("\x1b[?25l") // hide the cursor
+	defer fmt.Print("\x1b[?25h\x1b[H\x1b[2J")
+
+	keysIn, err := openKeys()
+	if err != nil {
+		return err
+	}
+	defer closeKeys(keysIn) // stops the reader, so that it does not steal the next key of the shell
+	input := make(chan string)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		defer close(input)
+		buf := make([]byte, 16)
+		for {
+			n, err := keysIn.Read(buf)
+			if err != nil {
+				return
+			}
+			select {
+			case input <- string(buf[:n]):
+			case <-done:
+				return
+			}
+		}
+	}()
+	snapshots := make(chan []TOPCLUSTER, 1)
+	collecting := false
+	refresh := func() {
+		if collecting {
+			return
+		}
+		collecting = true
+		go func() { snapshots <- collectTop(servers) }()
+	}
+	ticker := time.NewTicker(top_refresh)
+	defer ticker.Stop()
+
+	var st TOPSTATE
+	var snapshot []TOPCLUSTER
+	var updated time.Time
+	refresh()
+	for {
+		keys := drawTop(os.Stdout, &st, snapshot, updated, collecting)
+		select {
+		case <-rootCtx.Done():
+			return nil
+		case <-ticker.C:
+			refresh()
+		case snapshot = <-snapshots:
+			collecting, updated = false, time.Now()
+		case in, ok := <-input:
+			if !ok {
+				return nil
+			}
+			switch in {
+			case "q", "\x03":
+				return nil
+			case "\x1b[A", "k":
+				st.move(-1, len(keys))
+			case "\x1b[B", "j":
+				st.move(1, len(keys))
+			case "\r", "\n", "\x1b[C", "l":
+				st.enter(keys)
+			case "\x7f", "\b", "\x1b", "\x1b[D", "h":
+				st.back()
+			case "r":
+				refresh()
+			}
+		}
+	}
+}
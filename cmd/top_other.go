@@ -0,0 +1,12 @@
+//go:build !(aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris)
+
+package cmd
+
+import "os"
+
+// Read the keys from stdin itself : a pending read only ends with the next key
+func openKeys() (*os.File, error) {
+	return os.Stdin, nil
+}
+
+func closeKeys(f *os.File) {}
@@ -0,0 +1,27 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+
+package cmd
+
+import (
+	"os"
+	"syscall"
+)
+
+// Open stdin again in non blocking mode, so that a pending read ends when the file is closed
+func openKeys() (*os.File, error) {
+	fd, err := syscall.Dup(int(os.Stdin.Fd()))
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.SetNonblock(fd, true); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	return os.NewFile(uintptr(fd), "stdin"), nil
+}
+
+// Close the keys reader, and set stdin (which shares the non blocking mode) back to blocking
+func closeKeys(f *os.File) {
+	f.Close()
+	logErr(syscall.SetNonblock(int(os.Stdin.Fd()), false))
+}
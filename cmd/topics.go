@@ -1,16 +1,12 @@
 package cmd
 
 import (
-	"bytes"
 	"fmt"
-	"os/exec"
 	"regexp"
 	"sort"
 	"strconv"
 	"strings"
-	"sync"
 
-	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
@@ -26,15 +22,20 @@ var topicsCmd = &cobra.Command{
 		if strings.TrimSpace(topics) != "" { // If topic defined display only these topics for all clusters
 			tpcs := strings.ReplaceAll(strings.TrimSpace(topics), ",", "\n") //input like topic1,topic2,topic3
 			for i := range servers {
-				servers[i].topics = tpcs
+				servers[i].topics = selectTopicList(tpcs)
 			}
 		} else { // Look for all topics in all clusters
 			getTopicsFromClusters(servers)
 		}
-		if short { // Display the topics for all clusters and exit
+		if topics_consumers {
+			displayTopicConsumers(servers)
+			return
+		}
+		if short && len(topics_where) == 0 && !topics_configReport && !topics_balance { // Display the topics for all clusters and exit
 			for _, s := range servers {
 				fmt.Printf("\n%s:\n", s.cluster)
 				fmt.Println(strings.TrimSpace(s.topics))
+				addWatchMetric("topics", float64(numberOfTopics(s.topics)))
 			}
 		} else { // Display the topics list with details for all clusters
 			displayTopicWithDetails(servers)
@@ -42,65 +43,84 @@ var topicsCmd = &cobra.Command{
 	},
 }
 
-var topics_describe bool
+var topics_describe, topics_overrides, topics_configReport, topics_balance, topics_consumers bool
+var topics_where []string
 
 func init() {
 	rootCmd.AddCommand(topicsCmd)
 	// Cobra supports local flags which will only run when this command is called directly, e.g.:
 	topicsCmd.Flags().BoolVarP(&topics_describe, "describe", "d", false, "Show the details of partitions")
+	topicsCmd.Flags().StringArrayVarP(&topics_where, "where", "", nil, "Display only the topics with the given config value, set on the topic or inherited (e.g. --where cleanup.policy=compact)")
+	topicsCmd.Flags().BoolVarP(&topics_overrides, "overrides", "", false, "Display only the configs set on the topic itself, not inherited from the broker or the kafka defaults")
+	topicsCmd.Flags().BoolVarP(&topics_balance, "balance", "", false, "Show the replicas and leaders per broker, and the partitions not led by their preferred replica")
+	topicsCmd.Flags().BoolVarP(&topics_configReport, "config-report", "", false, "Display for each cluster how many topics override each config key, and with which values")
+	topicsCmd.Flags().BoolVarP(&topics_consumers, "consumers", "", false, "Display for each topic the consumer groups having committed offsets on it, with their state and lag, and the topics without consumer group")
 }
 
 type topicDetails struct {
 	name, config                string
+	configs                     map[string]string // config parsed from the raw string
 	nbOfPartitions, replication int
 	partitions                  []string
+	parts                       []PARTITION            // partitions parsed from the raw lines
+	allConfigs                  map[string]TOPICCONFIG // all configs with their source, only with --where, --overrides and --config-report
 }
 
 func displayTopicWithDetails(servers []SERVER) {
-	var wg sync.WaitGroup
+	var tasks TASKS
 	for _, s := range servers {
-		wg.Add(1)
-		go func(s SERVER) {
+		s := s
+		tasks.Go(s.bootstrap, func() {
 			topicsDetailed, err := getDetails(s.bootstrap, strings.Split(strings.TrimSpace(s.topics), "\n"))
+			if err == nil && (len(topics_where) > 0 || topics_overrides || topics_configReport) {
+				err = fillTopicConfigs(s.bootstrap, topicsDetailed)
+			}
+			if err == nil {
+				topicsDetailed, err = filterTopicsWhere(topicsDetailed, topics_where)
+			}
 			if err != nil {
-				log.Error("Error:", s.cluster, ":", err)
+				clusterError(s.cluster, err)
 			} else {
 				sortTopicsDetails(&topicsDetailed)
-				fmt.Println(strings.Join([]string{s.cluster, toString(topicsDetailed, nil)}, "\n"))
+				nT, nP, _ := sumTopicsDetails(topicsDetailed)
+				addWatchMetric("topics", float64(nT))
+				addWatchMetric("partitions", float64(nP))
+				if topics_configReport {
+					fmt.Println(strings.Join([]string{s.cluster, configReport(topicsDetailed)}, "\n"))
+				} else if topics_balance {
+					fmt.Println(strings.Join([]string{s.cluster, balanceToString(topicsDetailed)}, "\n"))
+				} else if short {
+					fmt.Println(strings.Join([]string{s.cluster, topicNames(topicsDetailed)}, "\n"))
+				} else {
+					fmt.Println(strings.Join([]string{s.cluster, toString(topicsDetailed, nil)}, "\n"))
+				}
 			}
-			wg.Done()
-		}(s)
+		})
 	}
-	wg.Wait()
+	tasks.Wait()
 }
 
 func getTopicsFromClusters(servers []SERVER) {
-	var wg sync.WaitGroup
+	var tasks TASKS
 	for i := range servers {
-		wg.Add(1)
-		go func(t *SERVER) {
+		t := &servers[i]
+		tasks.Go(t.bootstrap, func() {
 			tpcs, err := topics_cmdList(t.bootstrap)
 			if err != nil {
-				log.Error(t.cluster, err)
+				clusterError(t.cluster, err)
 			} else {
-				t.topics = tpcs
+				t.topics = selectTopicList(tpcs)
 			}
-			wg.Done()
-		}(&servers[i])
+		})
 	}
-	wg.Wait()
+	tasks.Wait()
 }
 
 // List all topics of the given cluster
 func topics_cmdList(broker string) (string, error) {
-	log.Debug("Run command : kafka-topics.sh --bootstrap-server " + broker + " --list")
-	ecmd := exec.Command("kafka-topics.sh", "--bootstrap-server", broker, "--list")
-	var out bytes.Buffer
-	ecmd.Stdout = &out
-	if err := ecmd.Run(); err != nil {
-		return "", err
-	}
-	return out.String(), nil
+	return session.cachedList("topics", broker, func() (string, error) {
+		return runCommand("kafka-topics.sh", "--bootstrap-server", broker, "--list")
+	})
 }
 
 func (t topicDetails) String() string {
@@ -120,7 +140,11 @@ func toString(at []topicDetails, wanted []string) string {
 	s := ""
 	for _, t := range at {
 		if wanted == nil || inArray(wanted, t.name) {
-			s += fmt.Sprintf("  %-*s : p=%2d  r=%d  c=%s\n", maxLName, t.name, t.nbOfPartitions, t.replication, t.config)
+			config := t.config
+			if topics_overrides {
+				config = configToString(configOverrides(t))
+			}
+			s += fmt.Sprintf("  %-*s : p=%2d  r=%d  c=%s\n", maxLName, t.name, t.nbOfPartitions, t.replication, config)
 			if topics_describe {
 				s += partitionsToString(t.partitions)
 				s += "\n"
@@ -144,54 +168,82 @@ func sortTopicsDetails(a *[]topicDetails) {
 	})
 }
 
-func topics_cmdForTopic(broker, topic string) (string, error) {
-	log.Debug("Run command : kafka-topics.sh --bootstrap-server " + broker + " --describe --topic " + topic)
-	ecmd := exec.Command("kafka-topics.sh", "--bootstrap-server", broker, "--describe", "--topic", topic)
-	var out bytes.Buffer
-	ecmd.Stdout = &out
-	if err := ecmd.Run(); err != nil {
-		return "", err
+// Above this number of topics, the whole cluster is described instead of building a topic regex
+const maxTopicsInRegex = 200
+
+// Describe the given topics with one single call : all topics of the cluster, or a regex matching the given topics
+func topics_cmdDescribe(broker string, topics []string) (string, error) {
+	if len(topics) > maxTopicsInRegex {
+		return runCommand("kafka-topics.sh", "--bootstrap-server", broker, "--describe")
 	}
-	return out.String(), nil
+	return runCommand("kafka-topics.sh", "--bootstrap-server", broker, "--describe", "--topic", topicsRegex(topics))
 }
 
+// Build a regex matching exactly the given topics
+func topicsRegex(topics []string) string {
+	quoted := make([]string, len(topics))
+	for i, t := range topics {
+		quoted[i] = regexp.QuoteMeta(t)
+	}
+	return "(" + strings.Join(quoted, "|") + ")"
+}
+
+// Describe the given topics of the cluster
 func getDetails(broker string, topics []string) ([]topicDetails, error) {
-	re := regexp.MustCompile(`^Topic:\s(.*)\s*PartitionCount:\s(\d*)\s*ReplicationFactor:\s(\d*)\s*Configs:\s(.*)$`)
+	wanted := make(map[string]bool)
+	names := make([]string, 0)
+	for _, t := range topics {
+		if t = strings.TrimSpace(t); t != "" && !wanted[t] {
+			wanted[t] = true
+			names = append(names, t)
+		}
+	}
 	tds := make([]topicDetails, 0)
-	var wg sync.WaitGroup
-	for _, topic := range topics {
-		wg.Add(1)
-		go func(t string, td *[]topicDetails) {
-			res, err := topics_cmdForTopic(broker, t)
-			if err != nil {
-				log.Println(err)
-				wg.Done()
-				return
-			}
-			lines := strings.Split(res, "\n")
-			for i := 0; i < len(lines); {
-				line := strings.TrimSpace(lines[i])
-				if re.MatchString(line) {
-					as := re.FindStringSubmatch(line)
-					if len(as) == 5 {
-						p, _ := strconv.Atoi(as[2])
-						r, _ := strconv.Atoi(as[3])
-						partitions := make([]string, p)
-						for j := 0; j < p; j++ {
-							partitions[j] = lines[j+i+1]
-						}
-						details := topicDetails{name: strings.TrimSpace(as[1]), nbOfPartitions: p, replication: r, config: as[4], partitions: partitions}
-						*td = append(*td, details)
-						i += p + 1
-					}
-					break
-				} else {
-					i += 1
-				}
-			}
-			wg.Done()
-		}(topic, &tds)
+	if len(names) == 0 {
+		return tds, nil
+	}
+	res, err := topics_cmdDescribe(broker, names)
+	if err != nil {
+		return nil, err
+	}
+	for _, td := range parseTopicsDescribe(res) {
+		if wanted[td.name] {
+			tds = append(tds, td)
+		}
 	}
-	wg.Wait()
 	return tds, nil
 }
+
+// Parse the output of kafka-topics.sh --describe, with or without the TopicId (kafka >= 2.8)
+func parseTopicsDescribe(stdout string) []topicDetails {
+	reOld := regexp.MustCompile(`^Topic:\s(.*)\s*PartitionCount:\s(\d*)\s*ReplicationFactor:\s(\d*)\s*Configs:\s*(.*)$`)
+	reNew := regexp.MustCompile(`^Topic:\s(.*)(\s*TopicId:\s.*)\s*PartitionCount:\s(\d*)\s*ReplicationFactor:\s(\d*)\s*Configs:\s*(.*)$`)
+	tds := make([]topicDetails, 0)
+	lines := strings.Split(stdout, "\n")
+	for i := 0; i < len(lines); {
+		line := strings.TrimSpace(lines[i])
+		var name, config string
+		var p, r int
+		if as := reNew.FindStringSubmatch(line); len(as) == 6 {
+			name, config = as[1], as[5]
+			p, _ = strconv.Atoi(as[3])
+			r, _ = strconv.Atoi(as[4])
+		} else if as := reOld.FindStringSubmatch(line); len(as) == 5 {
+			name, config = as[1], as[4]
+			p, _ = strconv.Atoi(as[2])
+			r, _ = strconv.Atoi(as[3])
+		} else {
+			i += 1
+			continue
+		}
+		partitions := make([]string, 0, p)
+		for j := 0; j < p && j+i+1 < len(lines); j++ {
+			partitions = append(partitions, lines[j+i+1])
+		}
+		name = strings.TrimSpace(name)
+		details := topicDetails{name: name, nbOfPartitions: p, replication: r, config: config, configs: parseTopicConfig(config), partitions: partitions, parts: parsePartitions(name, partitions)}
+		tds = append(tds, details)
+		i += len(partitions) + 1
+	}
+	return tds
+}
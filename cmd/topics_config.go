@@ -0,0 +1,184 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// A config of a topic as described by kafka-configs.sh --all, with the source of its value
+type TOPICCONFIG struct {
+	value, source string // source e.g. DYNAMIC_TOPIC_CONFIG, STATIC_BROKER_CONFIG, DEFAULT_CONFIG
+}
+
+// Source of the configs set on the topic itself
+const TOPIC_CONFIG_SOURCE = "DYNAMIC_TOPIC_CONFIG"
+
+// Describe all the configs of all the topics of the cluster, with their source
+func topics_cmdConfigs(broker string) (string, error) {
+	return runCommand("kafka-configs.sh", "--bootstrap-server", broker, "--describe", "--entity-type", "topics", "--all")
+}
+
+// Parse the output of kafka-configs.sh --describe --entity-type topics --all, e.g.
+// All configs for topic orders are:
+//
+//	retention.ms=86400000 sensitive=false synonyms={DYNAMIC_TOPIC_CONFIG:retention.ms=86400000, DEFAULT_CONFIG:log.retention.ms=604800000}
+func parseTopicConfigs(out string) map[string]map[string]TOPICCONFIG {
+	reTopic := regexp.MustCompile(`^All configs for topic (.*) are:$`)
+	res := make(map[string]map[string]TOPICCONFIG)
+	var current map[string]TOPICCONFIG
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if as := reTopic.FindStringSubmatch(line); len(as) == 2 {
+			current = make(map[string]TOPICCONFIG)
+			res[as[1]] = current
+			continue
+		}
+		i := strings.Index(line, " sensitive=")
+		if current == nil || i < 0 {
+			continue
+		}
+		kv := strings.SplitN(line[:i], "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		source := ""
+		if j := strings.Index(line, "synonyms={"); j >= 0 {
+			source = strings.SplitN(line[j+len("synonyms={"):], ":", 2)[0]
+			source = strings.TrimSuffix(source, "}")
+		}
+		current[kv[0]] = TOPICCONFIG{value: kv[1], source: source}
+	}
+	return res
+}
+
+// Add to the topics all their configs with their source, needed to find the overrides
+func fillTopicConfigs(broker string, at []topicDetails) error {
+	out, err := topics_cmdConfigs(broker)
+	if err != nil {
+		return err
+	}
+	all := parseTopicConfigs(out)
+	for i := range at {
+		at[i].allConfigs = all[at[i].name]
+	}
+	return nil
+}
+
+// Parse the raw "Configs:" string of kafka-topics.sh --describe (e.g. cleanup.policy=compact,delete,retention.ms=1000)
+func parseTopicConfig(raw string) map[string]string {
+	res := make(map[string]string)
+	last := ""
+	for _, kv := range strings.Split(strings.TrimSpace(raw), ",") {
+		kvs := strings.SplitN(kv, "=", 2)
+		if len(kvs) == 2 {
+			last = strings.TrimSpace(kvs[0])
+			res[last] = kvs[1]
+		} else if last != "" { // value containing a comma
+			res[last] += "," + kv
+		}
+	}
+	return res
+}
+
+// Return only the configs set on the topic itself, according to the source given by kafka-configs.sh;
+// without it, the configs of kafka-topics.sh --describe
+func configOverrides(t topicDetails) map[string]string {
+	if t.allConfigs == nil {
+		return t.configs
+	}
+	res := make(map[string]string)
+	for k, c := range t.allConfigs {
+		if c.source == TOPIC_CONFIG_SOURCE {
+			res[k] = c.value
+		}
+	}
+	return res
+}
+
+// Value of the config of the topic : its own value, or the one it inherits from the broker or the kafka default
+func topicConfigValue(t topicDetails, key string) string {
+	if c, exist := t.allConfigs[key]; exist {
+		return c.value
+	}
+	return t.configs[key]
+}
+
+// Keep only the topics matching all the conditions of the form key=value
+func filterTopicsWhere(at []topicDetails, where []string) ([]topicDetails, error) {
+	if len(where) == 0 {
+		return at, nil
+	}
+	conditions := make([][]string, 0, len(where))
+	for _, w := range where {
+		kv := strings.SplitN(w, "=", 2)
+		if len(kv) != 2 {
+			return nil, errors.New("Bad --where " + w + " : should be like cleanup.policy=compact")
+		}
+		conditions = append(conditions, []string{strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])})
+	}
+	res := make([]topicDetails, 0)
+	for _, t := range at {
+		match := true
+		for _, c := range conditions {
+			if topicConfigValue(t, c[0]) != c[1] {
+				match = false
+				break
+			}
+		}
+		if match {
+			res = append(res, t)
+		}
+	}
+	return res, nil
+}
+
+func topicNames(at []topicDetails) string {
+	names := make([]string, len(at))
+	for i, t := range at {
+		names[i] = t.name
+	}
+	return strings.Join(names, "\n")
+}
+
+// For each config key, count the topics overriding it and with which values
+func configReport(at []topicDetails) string {
+	counts := make(map[string]map[string]int)
+	for _, t := range at {
+		for k, v := range configOverrides(t) {
+			if counts[k] == nil {
+				counts[k] = make(map[string]int)
+			}
+			counts[k][v]++
+		}
+	}
+	keys := make([]string, 0, len(counts))
+	maxL := -1
+	for k := range counts {
+		keys = append(keys, k)
+		maxL = max(maxL, len(k))
+	}
+	sort.Strings(keys)
+	s := fmt.Sprintf("  %d topics\n", len(at))
+	for _, k := range keys {
+		values := make([]string, 0, len(counts[k]))
+		for v := range counts[k] {
+			values = append(values, v)
+		}
+		sort.Slice(values, func(i, j int) bool {
+			if counts[k][values[i]] == counts[k][values[j]] {
+				return values[i] < values[j]
+			}
+			return counts[k][values[i]] > counts[k][values[j]]
+		})
+		n := 0
+		for i, v := range values {
+			n += counts[k][v]
+			values[i] = fmt.Sprintf("%s x%d", v, counts[k][v])
+		}
+		s += fmt.Sprintf("  %-*s : %4d topics [%s]\n", maxL, k, n, strings.Join(values, ", "))
+	}
+	return s
+}
@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestTopicConfigsFromSource(t *testing.T) {
+	replayTestdata(t)
+	tds, err := getDetails(fixtureBootstrap, []string{"orders", "payments"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fillTopicConfigs(fixtureBootstrap, tds); err != nil {
+		t.Fatal(err)
+	}
+	// min.insync.replicas=2 is set on orders, inherited from the broker by payments
+	want := map[string]string{
+		"orders":   "map[min.insync.replicas:2 retention.ms:86400000]",
+		"payments": "map[cleanup.policy:compact,delete]",
+	}
+	for _, td := range tds {
+		if got := fmt.Sprint(configOverrides(td)); got != want[td.name] {
+			t.Errorf("overrides of %s = %s, want %s", td.name, got, want[td.name])
+		}
+	}
+	for where, names := range map[string]string{
+		"min.insync.replicas=2":   "orders\npayments",
+		"segment.bytes=536870912": "orders\npayments",
+		"cleanup.policy=delete":   "orders",
+		"retention.ms=604800000":  "payments",
+	} {
+		selected, err := filterTopicsWhere(tds, []string{where})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := topicNames(selected); got != names {
+			t.Errorf("--where %s : %q, want %q", where, got, names)
+		}
+	}
+	if _, err := filterTopicsWhere(tds, []string{"cleanup.policy"}); err == nil {
+		t.Error("no error for a condition without =")
+	}
+}
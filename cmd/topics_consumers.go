@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// A consumer group having committed offsets on a topic
+type TOPICCONSUMER struct {
+	group, state string
+	lag          int64 // total lag of the group on the topic
+}
+
+// The consumer groups of each topic, from the offsets of all the groups; the topics without group have an empty list
+func topicConsumers(tpcs []string, offsets []OFFSET, states []GROUP) map[string][]TOPICCONSUMER {
+	state := make(map[string]string)
+	for _, g := range states {
+		state[g.name] = g.state
+	}
+	lags := make(map[string]map[string]int64)
+	for _, t := range tpcs {
+		lags[t] = make(map[string]int64)
+	}
+	for _, o := range offsets {
+		if lags[o.topic] == nil {
+			continue
+		}
+		if o.lag > 0 {
+			lags[o.topic][o.group] += o.lag
+		} else if _, exist := lags[o.topic][o.group]; !exist {
+			lags[o.topic][o.group] = 0
+		}
+	}
+	res := make(map[string][]TOPICCONSUMER)
+	for t, groups := range lags {
+		cs := make([]TOPICCONSUMER, 0, len(groups))
+		for g, l := range groups {
+			cs = append(cs, TOPICCONSUMER{group: g, state: state[g], lag: l})
+		}
+		sort.Slice(cs, func(i, j int) bool {
+			if cs[i].lag == cs[j].lag {
+				return cs[i].group < cs[j].group
+			}
+			return cs[i].lag > cs[j].lag
+		})
+		res[t] = cs
+	}
+	return res
+}
+
+func topicConsumersToString(consumers map[string][]TOPICCONSUMER) string {
+	tpcs := make([]string, 0, len(consumers))
+	maxL := 0
+	for t, cs := range consumers {
+		tpcs = append(tpcs, t)
+		for _, c := range cs {
+			maxL = max(maxL, len(c.group))
+		}
+	}
+	sort.Strings(tpcs)
+	var sb strings.Builder
+	none := 0
+	for _, t := range tpcs {
+		cs := consumers[t]
+		if len(cs) == 0 {
+			sb.WriteString(fmt.Sprintf("  %s : NO CONSUMER GROUP\n", t))
+			none++
+			continue
+		}
+		if short {
+			names := make([]string, len(cs))
+			for i, c := range cs {
+				names[i] = fmt.Sprintf("%s (%s, lag %d)", c.group, c.state, c.lag)
+			}
+			sb.WriteString(fmt.Sprintf("  %s : %s\n", t, strings.Join(names, ", ")))
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("  %s : %d group(s)\n", t, len(cs)))
+		for _, c := range cs {
+			state := c.state
+			if state == "" {
+				state = "-"
+			}
+			sb.WriteString(fmt.Sprintf("      %-*s  %-19s  lag %d\n", maxL, c.group, state, c.lag))
+		}
+	}
+	sb.WriteString(fmt.Sprintf("  %d topic(s), %d without consumer group\n", len(tpcs), none))
+	addWatchMetric("unconsumed", float64(none))
+	return sb.String()
+}
+
+// Display who reads each topic of the servers
+func displayTopicConsumers(servers []SERVER) {
+	var tasks TASKS
+	outputs := make([]string, len(servers))
+	for i, s := range servers {
+		i, s := i, s
+		tasks.Go(s.bootstrap, func() {
+			out, err := group_offsets_cmd(s.bootstrap)
+			if err != nil {
+				clusterError(s.cluster, err)
+				return
+			}
+			offsets := parseGroupOffsets(out)
+			out, err = group_states_cmd(s.bootstrap)
+			if err != nil {
+				clusterError(s.cluster, err)
+				return
+			}
+			tpcs := strings.Fields(s.topics)
+			outputs[i] = topicConsumersToString(topicConsumers(tpcs, offsets, parseGroupStates(out)))
+		})
+	}
+	tasks.Wait()
+	for i, s := range servers {
+		if outputs[i] != "" {
+			fmt.Println(s.cluster)
+			fmt.Print(outputs[i])
+		}
+	}
+}
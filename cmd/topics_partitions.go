@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// One partition of a topic as displayed by kafka-topics.sh --describe
+type PARTITION struct {
+	topic                             string
+	id, leader                        int // leader is -1 if none
+	replicas, isr, offline, observers []int
+}
+
+var rePartitionFields = map[string]*regexp.Regexp{
+	"Partition": regexp.MustCompile(`Partition:\s*(\d+)`),
+	"Leader":    regexp.MustCompile(`Leader:\s*(-?\d+|none)`),
+	"Replicas":  regexp.MustCompile(`Replicas:\s*([\d,]*)`),
+	"Isr":       regexp.MustCompile(`Isr:\s*([\d,]*)`),
+	"Offline":   regexp.MustCompile(`Offline:\s*([\d,]*)`),
+	"Observers": regexp.MustCompile(`Observers:\s*([\d,]*)`),
+}
+
+// Parse a partition line (e.g. Topic: t1	Partition: 0	Leader: 1	Replicas: 1,2,3	Isr: 1,2,3)
+func parsePartition(topic, line string) (PARTITION, bool) {
+	fields := make(map[string]string)
+	for k, re := range rePartitionFields {
+		if as := re.FindStringSubmatch(line); len(as) == 2 {
+			fields[k] = as[1]
+		}
+	}
+	id, err := strconv.Atoi(fields["Partition"])
+	if err != nil {
+		return PARTITION{}, false
+	}
+	leader, err := strconv.Atoi(fields["Leader"])
+	if err != nil {
+		leader = -1
+	}
+	return PARTITION{
+		topic:     topic,
+		id:        id,
+		leader:    leader,
+		replicas:  toInts(fields["Replicas"]),
+		isr:       toInts(fields["Isr"]),
+		offline:   toInts(fields["Offline"]),
+		observers: toInts(fields["Observers"]),
+	}, true
+}
+
+func parsePartitions(topic string, lines []string) []PARTITION {
+	parts := make([]PARTITION, 0, len(lines))
+	for _, l := range lines {
+		if p, ok := parsePartition(topic, l); ok {
+			parts = append(parts, p)
+		}
+	}
+	return parts
+}
+
+// Convert "1,2,3" into [1 2 3]
+func toInts(s string) []int {
+	res := make([]int, 0)
+	for _, v := range strings.Split(s, ",") {
+		if i, err := strconv.Atoi(strings.TrimSpace(v)); err == nil {
+			res = append(res, i)
+		}
+	}
+	return res
+}
+
+// The preferred leader is the first replica
+func (p PARTITION) preferredLeader() int {
+	if len(p.replicas) == 0 {
+		return -1
+	}
+	return p.replicas[0]
+}
+
+func (p PARTITION) isPreferredLeader() bool {
+	return p.leader == p.preferredLeader()
+}
+
+func (p PARTITION) String() string {
+	return fmt.Sprintf("%s-%d leader=%d replicas=%s isr=%s", p.topic, p.id, p.leader, intJoin(p.replicas, ","), intJoin(p.isr, ","))
+}
+
+type BROKERBALANCE struct {
+	broker, replicas, leaders, preferred int
+}
+
+// Count for each broker the replicas, the leaders and the partitions it should lead (first replica)
+func leaderBalance(at []topicDetails) []BROKERBALANCE {
+	m := make(map[int]*BROKERBALANCE)
+	get := func(b int) *BROKERBALANCE {
+		if m[b] == nil {
+			m[b] = &BROKERBALANCE{broker: b}
+		}
+		return m[b]
+	}
+	for _, t := range at {
+		for _, p := range t.parts {
+			for _, r := range p.replicas {
+				get(r).replicas++
+			}
+			if p.leader >= 0 {
+				get(p.leader).leaders++
+			}
+			if pl := p.preferredLeader(); pl >= 0 {
+				get(pl).preferred++
+			}
+		}
+	}
+	res := make([]BROKERBALANCE, 0, len(m))
+	for _, b := range m {
+		res = append(res, *b)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].broker < res[j].broker })
+	return res
+}
+
+// Return the partitions which are not led by their preferred replica
+func notPreferredLeaders(at []topicDetails) []PARTITION {
+	res := make([]PARTITION, 0)
+	for _, t := range at {
+		for _, p := range t.parts {
+			if !p.isPreferredLeader() {
+				res = append(res, p)
+			}
+		}
+	}
+	return res
+}
+
+func balanceToString(at []topicDetails) string {
+	s := fmt.Sprintf("  %6s  %8s  %7s  %9s  %9s\n", "BROKER", "REPLICAS", "LEADERS", "PREFERRED", "IMBALANCE")
+	for _, b := range leaderBalance(at) {
+		s += fmt.Sprintf("  %6d  %8d  %7d  %9d  %+9d\n", b.broker, b.replicas, b.leaders, b.preferred, b.leaders-b.preferred)
+	}
+	np := notPreferredLeaders(at)
+	s += fmt.Sprintf("  Partitions not led by their preferred replica: %d\n", len(np))
+	if !short {
+		for _, p := range np {
+			s += "\t" + p.String() + "\n"
+		}
+	}
+	return s
+}
@@ -0,0 +1,283 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// Represent the plan command
+var planCmd = &cobra.Command{
+	Use:   "plan",
+	Short: "[ERDING] Compare a topics description file with the clusters and display the changes to apply",
+	Long: `Read a YAML file describing the topics of each cluster, compare it with the topics of the clusters
+  and display the plan : topics to create, partitions to add, configs to alter and topics missing from the file.
+  The changes are applied only with the --apply option, after confirmation.
+	e.g. go run kstat.go -c bkt28 plan -f topics.yaml
+	e.g. go run kstat.go -c bkt28 plan -f topics.yaml --apply
+  File format:
+	bkt28:
+	  - name: topic1
+	    partitions: 6
+	    replication: 3
+	    config:
+	      retention.ms: 86400000
+	      cleanup.policy: compact,delete `,
+
+	Run: func(cmd *cobra.Command, args []string) {
+		if strings.TrimSpace(plan_file) == "" {
+			logFatal(errors.New("No topics file defined : please use the --file command line option"))
+		}
+		specs, err := loadTopicSpecs(plan_file)
+		logFatal(err)
+		servers, err := initServers()
+		logFatal(err)
+		plans := make([][]PLANACTION, len(servers))
+		var tasks TASKS
+		for i := range servers {
+			spec, exist := specs[servers[i].cluster]
+			if !exist {
+				log.Warn("No topics defined for cluster " + servers[i].cluster + " in " + plan_file)
+				continue
+			}
+			i := i
+			tasks.Go(servers[i].bootstrap, func() {
+				plan, err := buildPlan(servers[i].bootstrap, spec)
+				if !logErr(err) {
+					plans[i] = plan
+				}
+			})
+		}
+		tasks.Wait()
+		nChanges := 0
+		for i, s := range servers {
+			if plans[i] == nil {
+				continue
+			}
+			fmt.Println(s.cluster + ":")
+			fmt.Print(plan_toString(plans[i]))
+			nChanges += countChanges(plans[i])
+		}
+		if !plan_apply || nChanges == 0 {
+			fmt.Printf("%d change(s) to apply\n", nChanges)
+			return
+		}
+		if !askConfirmation(fmt.Sprintf("Apply %d change(s)?", nChanges)) {
+			fmt.Println("Nothing applied")
+			return
+		}
+		for i, s := range servers {
+			for _, a := range plans[i] {
+				if a.command == "" {
+					continue
+				}
+				out, err := plan_runCmd(a.command, a.args)
+				if logErr(err) {
+					continue
+				}
+				fmt.Printf("%s: %s %s done\n%s", s.cluster, a.kind, a.topic, out)
+			}
+		}
+	},
+}
+
+var plan_file string
+var plan_apply bool
+
+func init() {
+	rootCmd.AddCommand(planCmd)
+	// Cobra supports local flags which will only run when this command is called directly, e.g.:
+	planCmd.Flags().StringVarP(&plan_file, "file", "f", "", "YAML file describing the topics of each cluster")
+	planCmd.Flags().BoolVarP(&plan_apply, "apply", "", false, "Apply the changes (after confirmation)")
+}
+
+// Description of a topic as found in the topics file
+type TOPICSPEC struct {
+	Name        string            `yaml:"name"`
+	Partitions  int               `yaml:"partitions"`
+	Replication int               `yaml:"replication"`
+	Config      map[string]string `yaml:"config"`
+}
+
+const (
+	PLAN_CREATE      = "create"
+	PLAN_PARTITIONS  = "partitions"
+	PLAN_CONFIG      = "config"
+	PLAN_REPLICATION = "replication"
+	PLAN_UNMANAGED   = "unmanaged"
+)
+
+// One step of the plan; command is empty if the step cannot be applied by kstat
+type PLANACTION struct {
+	kind, topic, detail string
+	command             string
+	args                []string
+}
+
+// Load the topics file : one list of topics per cluster
+func loadTopicSpecs(filename string) (map[string][]TOPICSPEC, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	specs := make(map[string][]TOPICSPEC)
+	if err := yaml.Unmarshal(data, &specs); err != nil {
+		return nil, err
+	}
+	for c, spec := range specs {
+		for _, t := range spec {
+			if strings.TrimSpace(t.Name) == "" || t.Partitions <= 0 || t.Replication <= 0 {
+				return nil, errors.New("Bad topic definition in cluster " + c + " : name, partitions and replication are mandatory")
+			}
+		}
+	}
+	return specs, nil
+}
+
+// Compare the wanted topics with the ones of the cluster
+func buildPlan(bootstrap string, spec []TOPICSPEC) ([]PLANACTION, error) {
+	list, err := topics_cmdList(bootstrap)
+	if err != nil {
+		return nil, err
+	}
+	names := strings.Fields(list)
+	details, err := getDetails(bootstrap, names)
+	if err != nil {
+		return nil, err
+	}
+	current := make(map[string]topicDetails)
+	for _, td := range details {
+		current[td.name] = td
+	}
+	plan := make([]PLANACTION, 0)
+	declared := make(map[string]bool)
+	for _, t := range spec {
+		declared[t.Name] = true
+		td, exist := current[t.Name]
+		if !exist {
+			args := []string{"--bootstrap-server", bootstrap, "--create", "--topic", t.Name,
+				"--partitions", strconv.Itoa(t.Partitions), "--replication-factor", strconv.Itoa(t.Replication)}
+			for _, k := range sortedKeys(t.Config) {
+				args = append(args, "--config", k+"="+t.Config[k])
+			}
+			detail := fmt.Sprintf("p=%d r=%d c=%s", t.Partitions, t.Replication, configToString(t.Config))
+			plan = append(plan, PLANACTION{kind: PLAN_CREATE, topic: t.Name, detail: detail, command: "kafka-topics.sh", args: args})
+			continue
+		}
+		if t.Partitions > td.nbOfPartitions {
+			args := []string{"--bootstrap-server", bootstrap, "--alter", "--topic", t.Name, "--partitions", strconv.Itoa(t.Partitions)}
+			detail := fmt.Sprintf("%d -> %d", td.nbOfPartitions, t.Partitions)
+			plan = append(plan, PLANACTION{kind: PLAN_PARTITIONS, topic: t.Name, detail: detail, command: "kafka-topics.sh", args: args})
+		} else if t.Partitions < td.nbOfPartitions {
+			detail := fmt.Sprintf("%d -> %d (partitions cannot be decreased)", td.nbOfPartitions, t.Partitions)
+			plan = append(plan, PLANACTION{kind: PLAN_PARTITIONS, topic: t.Name, detail: detail})
+		}
+		if t.Replication != td.replication {
+			detail := fmt.Sprintf("%d -> %d (use kafka-reassign-partitions.sh)", td.replication, t.Replication)
+			plan = append(plan, PLANACTION{kind: PLAN_REPLICATION, topic: t.Name, detail: detail})
+		}
+		if a, ok := planConfig(bootstrap, t, td.configs); ok {
+			plan = append(plan, a)
+		}
+	}
+	for _, name := range names {
+		if !declared[name] && !isInternalTopic(name) && selectedTopic(name) {
+			plan = append(plan, PLANACTION{kind: PLAN_UNMANAGED, topic: name, detail: "not in the topics file"})
+		}
+	}
+	return plan, nil
+}
+
+// Compute the configs to add for the given topic; return false if nothing has to be changed
+func planConfig(bootstrap string, t TOPICSPEC, current map[string]string) (PLANACTION, bool) {
+	add := make([]string, 0)
+	for _, k := range sortedKeys(t.Config) {
+		if v, exist := current[k]; !exist || v != t.Config[k] {
+			add = append(add, k+"="+configValue(t.Config[k]))
+		}
+	}
+	if len(add) == 0 {
+		return PLANACTION{}, false
+	}
+	args := []string{"--bootstrap-server", bootstrap, "--alter", "--entity-type", "topics", "--entity-name", t.Name, "--add-config", strings.Join(add, ",")}
+	return PLANACTION{kind: PLAN_CONFIG, topic: t.Name, detail: "add " + strings.Join(add, ","), command: "kafka-configs.sh", args: args}, true
+}
+
+// kafka-configs.sh needs square brackets around values containing commas (e.g. cleanup.policy=[compact,delete])
+func configValue(v string) string {
+	if strings.Contains(v, ",") {
+		return "[" + v + "]"
+	}
+	return v
+}
+
+func configToString(c map[string]string) string {
+	s := make([]string, 0, len(c))
+	for _, k := range sortedKeys(c) {
+		s = append(s, k+"="+c[k])
+	}
+	return strings.Join(s, ",")
+}
+
+// Return the keys of the map sorted
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func countChanges(plan []PLANACTION) int {
+	n := 0
+	for _, a := range plan {
+		if a.command != "" {
+			n++
+		}
+	}
+	return n
+}
+
+func plan_toString(plan []PLANACTION) string {
+	if len(plan) == 0 {
+		return "  up to date\n"
+	}
+	maxL := -1
+	for _, a := range plan {
+		maxL = max(maxL, len(a.topic))
+	}
+	s := ""
+	for _, a := range plan {
+		sign := "~"
+		switch {
+		case a.kind == PLAN_CREATE:
+			sign = "+"
+		case a.kind == PLAN_UNMANAGED:
+			sign = "?"
+		case a.command == "":
+			sign = "!"
+		}
+		s += fmt.Sprintf("  %s %-11s %-*s  %s\n", sign, a.kind, maxL, a.topic, a.detail)
+	}
+	return s
+}
+
+// Ask the user to type yes before going on
+func askConfirmation(question string) bool {
+	fmt.Printf("%s Type yes to confirm:\n", question)
+	var answer string
+	fmt.Scanln(&answer)
+	return strings.TrimSpace(answer) == "yes"
+}
+
+func plan_runCmd(command string, args []string) (string, error) {
+	return runMutatingCommand(command, args...)
+}
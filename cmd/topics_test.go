@@ -0,0 +1,23 @@
+package cmd
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestGetDetailsGolden(t *testing.T) {
+	replayTestdata(t)
+	tds, err := getDetails(fixtureBootstrap, []string{"orders", "payments", " orders", ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := topics_describe
+	topics_describe = true
+	defer func() { topics_describe = saved }()
+	sortTopicsDetails(&tds)
+	got := toString(tds, nil)
+	for _, td := range tds {
+		got += fmt.Sprintf("%s : %v %v\n", td.name, td.configs, td.parts)
+	}
+	checkGolden(t, "topics_details", got)
+}
@@ -8,6 +8,7 @@ import (
 	"os"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -60,11 +61,17 @@ type METRIC struct {
 }
 
 type BROKERMETRICS struct {
+	host    string
+	id      int // broker id from the cluster metadata or the inventory, -1 if unknown
 	metrics map[string]METRIC
 }
 
 type SERVER struct {
 	cluster, bootstrap, topics string
+	branch                     string         // git branch of the inventory, if any
+	zookeepers                 string         // zookeeper servers (host:2181) when known from the git or --inv inventory
+	inventory                  bool           // built from an inventory, so that no zookeeper means a KRaft cluster
+	brokerids                  map[string]int // broker_id of the hosts of the git inventory, if set
 	groups                     []GROUP
 	brokermetrics              []BROKERMETRICS // One BROKERMETRICS per broker
 	logdirs                    LOGDIRS
@@ -80,6 +87,9 @@ func buildInventoryFromGit(invType string) (string, error) {
 
 //  Construct the struct of servers (clustername and bootstrap servers)
 func initServers() ([]SERVER, error) {
+	if servers, ok := session.getServers(serversKey()); ok {
+		return servers, nil
+	}
 	var servers []SERVER
 	var err error
 	if strings.TrimSpace(gitBranch) != "" { // Build the inventory from git branch
@@ -90,9 +100,15 @@ func initServers() ([]SERVER, error) {
 		servers, err = buildServers() // Build the inventory from the command line [-c cluster1,cluster2,...] or [-b fqdn:port]
 	}
 	log.Debug(servers)
+	registerServers(servers)
+	if err == nil {
+		session.putServers(serversKey(), servers)
+	}
 	return servers, err
 }
 
+// Read the ansible-like --inv file : one group per cluster, the hosts of a cluster also in [zk_servers] being its zookeepers
+// (all the hosts of [zk_servers] when the file has a single cluster)
 func LoadInvFile() ([]SERVER, error) {
 	file, err := os.Open(invFile)
 	if err != nil {
@@ -103,24 +119,49 @@ func LoadInvFile() ([]SERVER, error) {
 	if err != nil {
 		return nil, err
 	}
+	zkHosts := make(map[string]bool)
+	if zg := cfg.Groups["zk_servers"]; zg != nil {
+		for h := range zg.Hosts {
+			zkHosts[h] = true
+		}
+	}
+	clusters := make([]string, 0)
+	for name := range cfg.Groups {
+		if name != "all" && name != "ungrouped" && name != "zk_servers" {
+			clusters = append(clusters, name)
+		}
+	}
 	servers := make([]SERVER, 0)
-	for _, g := range cfg.Groups {
-		if g.Name == "all" || g.Name == "ungrouped" {
-			continue
+	for _, c := range clusters {
+		inv, zks := make([]string, 0), make([]string, 0)
+		for h := range cfg.Groups[c].Hosts {
+			if zkHosts[h] {
+				zks = append(zks, h+":2181")
+			} else {
+				inv = append(inv, h+":9092")
+			}
 		}
-		inv := make([]string, 0)
-		for h := range g.Hosts {
-			inv = append(inv, h+":9092")
+		if len(clusters) == 1 && len(zks) == 0 {
+			for h := range zkHosts {
+				zks = append(zks, h+":2181")
+			}
 		}
-		servers = append(servers, SERVER{cluster: g.Name, bootstrap: strings.Join(inv, ",")})
+		sort.Strings(inv) // the recordings are keyed by the command line
+		sort.Strings(zks)
+		servers = append(servers, SERVER{cluster: c, bootstrap: strings.Join(inv, ","), zookeepers: strings.Join(zks, ","), inventory: true})
 	}
 	return servers, nil
 }
 
 // Construct the struct of servers (clustername and bootstrap servers) for each cluster from the git branch inventory
 func buildServersFromGit() ([]SERVER, error) {
+	return buildServersFromBranch(gitBranch)
+}
+
+// Construct the struct of servers for each cluster of the given git branch
+func buildServersFromBranch(branch string) ([]SERVER, error) {
 	servers := make([]SERVER, 0)
-	fs, err := cloneInMemory(gitBranch)
+	fs, err := cloneInMemory(branch)
 	if err != nil {
 		return nil, err
 	}
@@ -147,10 +188,22 @@ func buildServersFromGit() ([]SERVER, error) {
 			}
 			if cfg.Groups["kafka_servers"].Hosts != nil {
 				boots := make([]string, 0)
-				for h := range cfg.Groups["kafka_servers"].Hosts {
+				ids := make(map[string]int)
+				for h, host := range cfg.Groups["kafka_servers"].Hosts {
 					boots = append(boots, h+":9092")
+					if id, err := strconv.Atoi(host.Vars["broker_id"]); err == nil {
+						ids[shortHost(h)] = id
+					}
 				}
-				servers = append(servers, SERVER{cluster: a.Name(), bootstrap: strings.Join(boots, ",")})
+				zks := make([]string, 0)
+				if cfg.Groups["zk_servers"] != nil {
+					for h := range cfg.Groups["zk_servers"].Hosts {
+						zks = append(zks, h+":2181")
+					}
+				}
+				sort.Strings(boots) // the recordings are keyed by the command line
+				sort.Strings(zks)
+				servers = append(servers, SERVER{cluster: a.Name(), branch: branch, bootstrap: strings.Join(boots, ","), zookeepers: strings.Join(zks, ","), inventory: true, brokerids: ids})
 			} else {
 				logErr(errors.New("No bootstrap servers found for cluster " + a.Name()))
 			}
@@ -218,6 +271,14 @@ func toCluster(brokers string) (string, error) {
 
 // Kind of telnet to the host:port
 func raw_connect(host, port string) (bool, error) {
+	_, _, err := recorded("conn "+net.JoinHostPort(host, port), func() (string, string, error) {
+		_, err := tcp_connect(host, port)
+		return "", "", err
+	}, plainError)
+	return err == nil, err
+}
+
+func tcp_connect(host, port string) (bool, error) {
 	log.Debug(fmt.Sprintf("Trying to connect to %s : %s in %d millis", host, port, timeout))
 	_timeout := time.Duration(timeout) * time.Millisecond
 	conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, port), _timeout)
@@ -256,6 +317,13 @@ func check_conn(servers string) error {
 
 func logFatal(err ...error) {
 	for _, e := range err {
+		if e != nil {
+			printErrorSummary() // PersistentPostRun is not run
+		}
+		if e != nil && session != nil { // do not leave the shell
+			log.Error(e)
+			panic(SHELLABORT{e})
+		}
 		if e != nil {
 			log.Fatal(e)
 		}
@@ -295,6 +363,17 @@ func askCredentials(paas string) {
 }
 
 func cloneInMemory(branch string) (billy.Filesystem, error) {
+	key := "git " + gitRepo + " " + branch
+	if replayDir != "" {
+		rec, err := loadRecording(key)
+		if err != nil {
+			return nil, err
+		}
+		return filesToFs(rec.Stdout)
+	}
+	if fs, ok := session.getFs(branch); ok {
+		return fs, nil
+	}
 	askCredentials("git")
 	fs := memfs.New()
 	log.Debug("Cloning " + gitRepo + " : " + branch)
@@ -309,6 +388,13 @@ func cloneInMemory(branch string) (billy.Filesystem, error) {
 	if err != nil {
 		return nil, err
 	}
+	if recordDir != "" {
+		content, err := filesOf(fs)
+		if !logErr(err) {
+			saveRecording(RECORDING{Key: key, Stdout: content})
+		}
+	}
+	session.putFs(branch, fs)
 	return fs, nil
 }
 
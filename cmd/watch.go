@@ -0,0 +1,330 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var watch time.Duration
+var until string
+
+func init() {
+	rootCmd.PersistentFlags().DurationVarP(&watch, "watch", "", 0, "Rerun the command at this interval and display the changes (health, group, partition, info, topic, acl, config, ktopic, kgroup)")
+	rootCmd.PersistentFlags().StringVarP(&until, "until", "", "", "With --watch, stop when the conditions are reached, comma separated (e.g. urp=0 or unav=0,urp<10)")
+}
+
+// Wrap the read commands, so that they can be run with --watch.
+// Called before the execution, once all the commands are defined.
+func initWatch() {
+	for _, c := range []*cobra.Command{healthCmd, groupCmd, partitionsCmd, infoCmd, topicsCmd, aclsCmd, configCmd, kTopicCmd, kGroupCmd} {
+		run := c.Run
+		c.Run = func(cmd *cobra.Command, args []string) {
+			if watch <= 0 && until == "" {
+				run(cmd, args)
+				return
+			}
+			logFatal(watchCommand(cmd, func() { run(cmd, args) }))
+		}
+	}
+}
+
+// Values exported by the commands for --until (e.g. urp, topics), summed over the clusters
+var watchMetrics = struct {
+	sync.Mutex
+	values map[string]float64
+}{values: make(map[string]float64)}
+
+func addWatchMetric(name string, value float64) {
+	watchMetrics.Lock()
+	defer watchMetrics.Unlock()
+	watchMetrics.values[name] += value
+}
+
+func resetWatchMetrics() map[string]float64 {
+	watchMetrics.Lock()
+	defer watchMetrics.Unlock()
+	values := watchMetrics.values
+	watchMetrics.values = make(map[string]float64)
+	return values
+}
+
+// A condition of --until, e.g. urp=0
+type CONDITION struct {
+	metric, op string
+	value      float64
+}
+
+func parseConditions(s string) ([]CONDITION, error) {
+	re := regexp.MustCompile(`^\s*([a-z_]+)\s*(<=|>=|!=|=|<|>)\s*(-?[0-9.]+)\s*$`)
+	res := make([]CONDITION, 0)
+	for _, c := range strings.Split(s, ",") {
+		if strings.TrimSpace(c) == "" {
+			continue
+		}
+		as := re.FindStringSubmatch(c)
+		if len(as) != 4 {
+			return nil, errors.New("Bad condition " + c + " : should be like urp=0")
+		}
+		v, err := strconv.ParseFloat(as[3], 64)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, CONDITION{metric: as[1], op: as[2], value: v})
+	}
+	return res, nil
+}
+
+// Return true if all the conditions are reached
+func conditionsReached(conds []CONDITION, values map[string]float64) (bool, error) {
+	for _, c := range conds {
+		v, exist := values[c.metric]
+		if !exist {
+			return false, errors.New("No value for " + c.metric + " in --until; available : " + strings.Join(sortedMetricNames(values), ","))
+		}
+		ok := false
+		switch c.op {
+		case "=":
+			ok = v == c.value
+		case "!=":
+			ok = v != c.value
+		case "<":
+			ok = v < c.value
+		case "<=":
+			ok = v <= c.value
+		case ">":
+			ok = v > c.value
+		case ">=":
+			ok = v >= c.value
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func sortedMetricNames(values map[string]float64) []string {
+	names := make([]string, 0, len(values))
+	for k := range values {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Run the command and return what it printed on stdout
+func captureOutput(run func()) (out string, err error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return "", err
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	var buf bytes.Buffer
+	done := make(chan struct{})
+	go func() {
+		io.Copy(&buf, r)
+		close(done)
+	}()
+	defer func() { // also when logFatal panics in the shell
+		os.Stdout = stdout
+		w.Close()
+		<-done
+		r.Close()
+		out = buf.String()
+	}()
+	run()
+	return "", nil
+}
+
+var reNumber = regexp.MustCompile(`-?[0-9]+(\.[0-9]+)?`)
+
+// Display the lines added (+) and removed (-); a line whose only numbers changed is displayed once (~) with the deltas
+func diffOutputs(previous, current string, color bool) string {
+	paint := func(code, s string) string {
+		if color {
+			return "\x1b[" + code + "m" + s + "\x1b[0m"
+		}
+		return s
+	}
+	a, b := strings.Split(strings.TrimRight(previous, "\n"), "\n"), strings.Split(strings.TrimRight(current, "\n"), "\n")
+	var res strings.Builder
+	removed, added := make([]string, 0), make([]string, 0)
+	flush := func() {
+		for _, r := range removed {
+			if i := sameShape(r, added); i >= 0 {
+				res.WriteString(paint("33", "~ "+numberDeltas(r, added[i])) + "\n")
+				added = append(added[:i], added[i+1:]...)
+			} else {
+				res.WriteString(paint("31", "- "+r) + "\n")
+			}
+		}
+		for _, l := range added {
+			res.WriteString(paint("32", "+ "+l) + "\n")
+		}
+		removed, added = removed[:0], added[:0]
+	}
+	for _, op := range diffLines(a, b) {
+		switch op.kind {
+		case '-':
+			removed = append(removed, op.line)
+		case '+':
+			added = append(added, op.line)
+		default:
+			flush()
+		}
+	}
+	flush()
+	if res.Len() == 0 {
+		return "  no change\n"
+	}
+	return res.String()
+}
+
+type DIFFOP struct {
+	kind byte // '=', '-' or '+'
+	line string
+}
+
+// Longest common subsequence of the lines, after the common first and last lines
+func diffLines(a, b []string) []DIFFOP {
+	ops := make([]DIFFOP, 0)
+	for len(a) > 0 && len(b) > 0 && a[0] == b[0] {
+		ops = append(ops, DIFFOP{'=', a[0]})
+		a, b = a[1:], b[1:]
+	}
+	suffix := make([]DIFFOP, 0)
+	for len(a) > 0 && len(b) > 0 && a[len(a)-1] == b[len(b)-1] {
+		suffix = append([]DIFFOP{{'=', a[len(a)-1]}}, suffix...)
+		a, b = a[:len(a)-1], b[:len(b)-1]
+	}
+	if len(a)*len(b) > 4000000 { // too big : all lines changed
+		for _, l := range a {
+			ops = append(ops, DIFFOP{'-', l})
+		}
+		for _, l := range b {
+			ops = append(ops, DIFFOP{'+', l})
+		}
+		return append(ops, suffix...)
+	}
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, DIFFOP{'=', a[i]})
+			i, j = i+1, j+1
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, DIFFOP{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, DIFFOP{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, DIFFOP{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, DIFFOP{'+', b[j]})
+	}
+	return append(ops, suffix...)
+}
+
+// Index of the first line equal to l once the numbers are removed, with as many numbers, or -1
+func sameShape(l string, lines []string) int {
+	shape, count := reNumber.ReplaceAllString(l, "#"), len(reNumber.FindAllString(l, -1))
+	for i, o := range lines { // a literal # (e.g. in a group name) has the shape of a number
+		if reNumber.ReplaceAllString(o, "#") == shape && len(reNumber.FindAllString(o, -1)) == count {
+			return i
+		}
+	}
+	return -1
+}
+
+// The new line, with the delta after each number which changed (e.g. URP:   1(-2))
+func numberDeltas(old, new string) string {
+	olds := reNumber.FindAllString(old, -1)
+	i := 0
+	return reNumber.ReplaceAllStringFunc(new, func(n string) string {
+		o := olds[i]
+		i++
+		if o == n {
+			return n
+		}
+		vo, err1 := strconv.ParseFloat(o, 64)
+		vn, err2 := strconv.ParseFloat(n, 64)
+		if err1 != nil || err2 != nil {
+			return n
+		}
+		return fmt.Sprintf("%s(%+g)", n, vn-vo)
+	})
+}
+
+// Rerun the command every --watch, displaying its output the first time and then the changes, until the --until conditions
+func watchCommand(cmd *cobra.Command, run func()) error {
+	conds, err := parseConditions(until)
+	if err != nil {
+		return err
+	}
+	interval := watch
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	color := term.IsTerminal(int(os.Stdout.Fd()))
+	var previous string
+	for i := 1; ; i++ {
+		resetWatchMetrics()
+		out, err := captureOutput(run)
+		if err != nil {
+			return err
+		}
+		values := resetWatchMetrics()
+		fmt.Printf("Every %s : %s, %s (iteration %d)\n", interval, cmd.CommandPath(), time.Now().Format("15:04:05"), i)
+		if i == 1 {
+			fmt.Print(out)
+		} else {
+			fmt.Print(diffOutputs(previous, out, color))
+		}
+		previous = out
+		if len(conds) > 0 {
+			ok, err := conditionsReached(conds, values)
+			if err != nil {
+				return err
+			}
+			if ok {
+				fmt.Println("Condition reached : " + until)
+				return nil
+			}
+		}
+		select {
+		case <-rootCtx.Done():
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
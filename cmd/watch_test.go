@@ -0,0 +1,56 @@
+package cmd
+
+import "testing"
+
+func TestDiffLines(t *testing.T) {
+	ops := diffLines([]string{"a", "b", "c", "d"}, []string{"a", "c", "e", "d"})
+	got := ""
+	for _, op := range ops {
+		got += string(op.kind) + op.line + " "
+	}
+	if want := "=a -b =c +e =d "; got != want {
+		t.Errorf("diff = %q, want %q", got, want)
+	}
+}
+
+func TestDiffOutputs(t *testing.T) {
+	for _, tc := range []struct{ previous, current, want string }{
+		{"bkt28 URP: 3\nbkt29 URP: 0\n", "bkt28 URP: 1\nbkt29 URP: 0\n", "~ bkt28 URP: 1(-2)\n"},
+		{"orders\npayments\n", "orders\nrefunds\n", "- payments\n+ refunds\n"},
+		{"GROUP test# LAG 5", "GROUP test1 LAG 7", "- GROUP test# LAG 5\n+ GROUP test1 LAG 7\n"},
+		{"GROUP test1 LAG 5", "GROUP test# LAG 7", "- GROUP test1 LAG 5\n+ GROUP test# LAG 7\n"},
+		{"same\n", "same\n", "  no change\n"},
+	} {
+		if got := diffOutputs(tc.previous, tc.current, false); got != tc.want {
+			t.Errorf("diff of %q and %q = %q, want %q", tc.previous, tc.current, got, tc.want)
+		}
+	}
+}
+
+func TestParseConditions(t *testing.T) {
+	conds, err := parseConditions("urp=0, lag<=10,topics!=-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []CONDITION{{"urp", "=", 0}, {"lag", "<=", 10}, {"topics", "!=", -1}}
+	if len(conds) != len(want) {
+		t.Fatalf("conditions = %v, want %v", conds, want)
+	}
+	for i := range want {
+		if conds[i] != want[i] {
+			t.Errorf("condition %d = %v, want %v", i, conds[i], want[i])
+		}
+	}
+	for _, bad := range []string{"urp", "urp==0", "URP=0", "urp=zero"} {
+		if _, err := parseConditions(bad); err == nil {
+			t.Errorf("%s parsed without error", bad)
+		}
+	}
+	reached, err := conditionsReached(conds, map[string]float64{"urp": 0, "lag": 12, "topics": 3})
+	if err != nil || reached {
+		t.Errorf("reached = %v, %v with lag 12, want false", reached, err)
+	}
+	if _, err := conditionsReached(conds, map[string]float64{"urp": 0}); err == nil {
+		t.Error("no error without a value for lag")
+	}
+}